@@ -0,0 +1,447 @@
+package python
+
+/*
+
+#include <Python.h>
+
+#include <stdint.h>
+#include <stdlib.h>
+
+extern void goReleaseBuffer(uintptr_t handle);
+
+// getBuffer fills in a contiguous view.  Objects which only implement the old
+// buffer protocol (such as array.array) get a byte view.  Returns 1 in that
+// case, 0 if the new buffer protocol was used, or -1 on error.
+static int getBuffer(PyObject *o, Py_buffer *view) {
+	void *buf;
+	Py_ssize_t len;
+	int readonly = 0;
+
+	if (PyObject_CheckBuffer(o)) {
+		return PyObject_GetBuffer(o, view, PyBUF_C_CONTIGUOUS | PyBUF_FORMAT);
+	}
+
+	if (PyObject_AsWriteBuffer(o, &buf, &len) < 0) {
+		PyErr_Clear();
+		readonly = 1;
+
+		if (PyObject_AsReadBuffer(o, (const void **) &buf, &len) < 0) {
+			return -1;
+		}
+	}
+
+	if (PyBuffer_FillInfo(view, o, buf, len, readonly, PyBUF_SIMPLE) < 0) {
+		return -1;
+	}
+
+	return 1;
+}
+
+// GoBufferObject exports Go memory.  The memory is kept pinned until the
+// object is deallocated.
+typedef struct {
+	PyObject_HEAD
+	void *buf;
+	Py_ssize_t len;
+	Py_ssize_t itemsize;
+	char *format;
+	Py_ssize_t shape[1];
+	uintptr_t handle;
+} GoBufferObject;
+
+static int GoBuffer_getbuffer(PyObject *o, Py_buffer *view, int flags) {
+	GoBufferObject *b = (GoBufferObject *) o;
+
+	if (PyBuffer_FillInfo(view, o, b->buf, b->len, 0, flags) < 0) {
+		return -1;
+	}
+
+	view->itemsize = b->itemsize;
+
+	if (flags & PyBUF_FORMAT) {
+		view->format = b->format;
+	}
+	if (flags & PyBUF_ND) {
+		view->shape = b->shape;
+	}
+
+	return 0;
+}
+
+static Py_ssize_t GoBuffer_getreadbuffer(PyObject *o, Py_ssize_t segment, void **ptr) {
+	GoBufferObject *b = (GoBufferObject *) o;
+
+	if (segment != 0) {
+		PyErr_SetString(PyExc_SystemError, "accessing non-existent buffer segment");
+		return -1;
+	}
+
+	*ptr = b->buf;
+	return b->len;
+}
+
+static Py_ssize_t GoBuffer_getsegcount(PyObject *o, Py_ssize_t *len) {
+	if (len) {
+		*len = ((GoBufferObject *) o)->len;
+	}
+	return 1;
+}
+
+static void GoBuffer_dealloc(PyObject *o) {
+	goReleaseBuffer(((GoBufferObject *) o)->handle);
+	PyObject_Del(o);
+}
+
+static PyBufferProcs GoBuffer_as_buffer = {
+	GoBuffer_getreadbuffer,
+	GoBuffer_getreadbuffer,
+	GoBuffer_getsegcount,
+	NULL,
+	GoBuffer_getbuffer,
+	NULL,
+};
+
+static PyTypeObject GoBufferType = {
+	PyVarObject_HEAD_INIT(NULL, 0)
+	"go.buffer",
+	sizeof (GoBufferObject),
+	0,
+	GoBuffer_dealloc,
+};
+
+static int initBufferType(void) {
+	GoBufferType.tp_as_buffer = &GoBuffer_as_buffer;
+	GoBufferType.tp_flags = Py_TPFLAGS_DEFAULT | Py_TPFLAGS_HAVE_NEWBUFFER;
+	return PyType_Ready(&GoBufferType);
+}
+
+static PyObject *GoBuffer_New(void *buf, Py_ssize_t len, Py_ssize_t itemsize, char *format, uintptr_t handle) {
+	GoBufferObject *b = PyObject_New(GoBufferObject, &GoBufferType);
+	if (b == NULL) {
+		return NULL;
+	}
+
+	b->buf = buf;
+	b->len = len;
+	b->itemsize = itemsize;
+	b->format = format;
+	b->shape[0] = len / itemsize;
+	b->handle = handle;
+
+	return (PyObject *) b;
+}
+
+static Py_buffer *newBufferView(void) {
+	return calloc(1, sizeof (Py_buffer));
+}
+
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/cgo"
+	"unsafe"
+)
+
+var (
+	formatBytes   = C.CString("B")
+	formatFloat32 = C.CString("f")
+	formatFloat64 = C.CString("d")
+	formatInt32   = C.CString("i")
+	formatInt64   = C.CString("q")
+
+	littleEndian = func() bool {
+		x := uint16(1)
+		return *(*byte)(unsafe.Pointer(&x)) == 1
+	}()
+)
+
+func initBuffer() {
+	if C.initBufferType() < 0 {
+		panic(getError())
+	}
+}
+
+// Buffer provides direct access to the memory of a Python object which
+// supports the buffer protocol.  The slices returned by its methods are valid
+// until Release is called.  A Buffer must be released explicitly: the Python
+// object may not be resized while it is being accessed, and the Buffer isn't
+// kept alive by the slices.  Buffer methods must not be called concurrently.
+type Buffer struct {
+	view     *C.Py_buffer
+	format   string
+	itemSize int
+	readOnly bool
+}
+
+func (o *object) Buffer(t *Thread) (b *Buffer, err error) {
+	t.execute(func() {
+		b, err = getBuffer(o.pyObject)
+	})
+	return
+}
+
+func getBuffer(pyObject *C.PyObject) (b *Buffer, err error) {
+	view := C.newBufferView()
+	if view == nil {
+		err = errors.New("out of memory")
+		return
+	}
+
+	legacy := C.getBuffer(pyObject, view)
+	if legacy < 0 {
+		C.free(unsafe.Pointer(view))
+		err = getError()
+		return
+	}
+
+	b = &Buffer{
+		view:     view,
+		format:   "B",
+		itemSize: int(view.itemsize),
+		readOnly: view.readonly != 0,
+	}
+
+	if legacy > 0 {
+		// array.array describes itself only via attributes.
+		if typecode, ok := legacyAttr(pyObject, "typecode").(string); ok {
+			if itemSize, ok := legacyAttr(pyObject, "itemsize").(int); ok {
+				b.format = typecode
+				b.itemSize = itemSize
+			}
+		}
+	} else if view.format != nil {
+		b.format = C.GoString(view.format)
+	}
+
+	return
+}
+
+// legacyAttr gets an attribute value, or nil on error.
+func legacyAttr(pyObject *C.PyObject, name string) (value interface{}) {
+	pyValue, err := getAttr(pyObject, name)
+	if err != nil {
+		return
+	}
+	defer C.Py_DecRef(pyValue)
+
+	value, _ = decode(pyValue)
+	return
+}
+
+// Release the underlying Python buffer.  The memory must not be accessed
+// afterwards.
+func (b *Buffer) Release(t *Thread) {
+	t.execute(func() {
+		b.release()
+	})
+}
+
+func (b *Buffer) release() {
+	if b.view != nil {
+		C.PyBuffer_Release(b.view)
+		C.free(unsafe.Pointer(b.view))
+		b.view = nil
+	}
+}
+
+// Format of the items in struct module syntax.
+func (b *Buffer) Format() string {
+	return b.format
+}
+
+// ItemSize in bytes.
+func (b *Buffer) ItemSize() int {
+	return b.itemSize
+}
+
+// ReadOnly buffers must not be modified.
+func (b *Buffer) ReadOnly() bool {
+	return b.readOnly
+}
+
+// Bytes accesses the raw memory.
+func (b *Buffer) Bytes() []byte {
+	if b.view == nil || b.view.len == 0 {
+		return nil
+	}
+
+	n := int(b.view.len)
+	return (*[1 << 40]byte)(b.view.buf)[:n:n]
+}
+
+// Float32s accesses memory with the "f" format.
+func (b *Buffer) Float32s() (s []float32, err error) {
+	p, n, err := b.items("f", 4)
+	if n > 0 {
+		s = (*[1 << 38]float32)(p)[:n:n]
+	}
+	return
+}
+
+// Float64s accesses memory with the "d" format.
+func (b *Buffer) Float64s() (s []float64, err error) {
+	p, n, err := b.items("d", 8)
+	if n > 0 {
+		s = (*[1 << 37]float64)(p)[:n:n]
+	}
+	return
+}
+
+// Int32s accesses memory with a 4-byte signed integer format.
+func (b *Buffer) Int32s() (s []int32, err error) {
+	p, n, err := b.items("ilq", 4)
+	if n > 0 {
+		s = (*[1 << 38]int32)(p)[:n:n]
+	}
+	return
+}
+
+// Int64s accesses memory with an 8-byte signed integer format.
+func (b *Buffer) Int64s() (s []int64, err error) {
+	p, n, err := b.items("ilq", 8)
+	if n > 0 {
+		s = (*[1 << 37]int64)(p)[:n:n]
+	}
+	return
+}
+
+// items checks that the format matches one of the codes and the item size.
+func (b *Buffer) items(codes string, size int) (p unsafe.Pointer, n int, err error) {
+	if b.view == nil {
+		err = errors.New("buffer has been released")
+		return
+	}
+
+	code := b.format
+
+	if len(code) == 2 {
+		switch code[0] {
+		case '@', '=':
+			code = code[1:]
+
+		case '<':
+			if littleEndian {
+				code = code[1:]
+			}
+
+		case '>', '!':
+			if !littleEndian {
+				code = code[1:]
+			}
+		}
+	}
+
+	if len(code) != 1 || !containsByte(codes, code[0]) || b.itemSize != size {
+		err = fmt.Errorf("buffer format %q with item size %d is incompatible with %d-byte %q", b.format, b.itemSize, size, codes)
+		return
+	}
+
+	p = b.view.buf
+	n = int(b.view.len) / size
+
+	if uintptr(p)%uintptr(size) != 0 {
+		err = fmt.Errorf("buffer is not aligned to %d bytes", size)
+		p = nil
+		n = 0
+	}
+	return
+}
+
+func containsByte(s string, c byte) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			return true
+		}
+	}
+	return false
+}
+
+// NewMemoryView exports a Go slice to Python as a writable memoryview object.
+// The slice type must be []byte, []float32, []float64, []int32 or []int64.
+// The memory is pinned until the memoryview (and any objects derived from it)
+// have been garbage collected by Python.
+func NewMemoryView(t *Thread, slice interface{}) (view Object, err error) {
+	var (
+		p        unsafe.Pointer
+		n        int
+		itemSize int
+		format   *C.char
+	)
+
+	switch s := slice.(type) {
+	case []byte:
+		if n = len(s); n > 0 {
+			p = unsafe.Pointer(&s[0])
+		}
+		itemSize = 1
+		format = formatBytes
+
+	case []float32:
+		if n = len(s); n > 0 {
+			p = unsafe.Pointer(&s[0])
+		}
+		itemSize = 4
+		format = formatFloat32
+
+	case []float64:
+		if n = len(s); n > 0 {
+			p = unsafe.Pointer(&s[0])
+		}
+		itemSize = 8
+		format = formatFloat64
+
+	case []int32:
+		if n = len(s); n > 0 {
+			p = unsafe.Pointer(&s[0])
+		}
+		itemSize = 4
+		format = formatInt32
+
+	case []int64:
+		if n = len(s); n > 0 {
+			p = unsafe.Pointer(&s[0])
+		}
+		itemSize = 8
+		format = formatInt64
+
+	default:
+		err = fmt.Errorf("unable to export %T as memoryview", slice)
+		return
+	}
+
+	pinner := new(runtime.Pinner)
+	if p != nil {
+		pinner.Pin(p)
+	}
+	handle := cgo.NewHandle(pinner)
+
+	t.execute(func() {
+		pyBuffer := C.GoBuffer_New(p, C.Py_ssize_t(n*itemSize), C.Py_ssize_t(itemSize), format, C.uintptr_t(handle))
+		if pyBuffer == nil {
+			releaseBuffer(handle)
+			err = getError()
+			return
+		}
+		defer C.Py_DecRef(pyBuffer)
+
+		pyView := C.PyMemoryView_FromObject(pyBuffer)
+		if pyView == nil {
+			err = getError()
+			return
+		}
+		defer C.Py_DecRef(pyView)
+
+		view = newObject(pyView)
+	})
+	return
+}
+
+// releaseBuffer unpins memory exported by NewMemoryView.
+func releaseBuffer(handle cgo.Handle) {
+	handle.Value().(*runtime.Pinner).Unpin()
+	handle.Delete()
+}
@@ -0,0 +1,76 @@
+package python
+
+/*
+
+#include <Python.h>
+
+*/
+import "C"
+
+import (
+	"sync"
+)
+
+// threads maps Python thread states to the Threads which own them.
+var threads sync.Map
+
+// currentThread finds the Thread which owns the Python thread state of the
+// calling OS thread.  A temporary Thread is returned if the Python thread was
+// not created by this package.  The GIL must be held.
+func currentThread() (t *Thread) {
+	if t = lookupThread(); t == nil {
+		t = &Thread{
+			queue: make(chan func(), 1),
+		}
+	}
+	return
+}
+
+// lookupThread is like currentThread, but returns nil if the Python thread was
+// not created by this package.
+func lookupThread() *Thread {
+	if x, found := threads.Load(C.PyThreadState_Get()); found {
+		return x.(*Thread)
+	}
+	return nil
+}
+
+// callGo runs Go code on behalf of Python code.  The GIL is released while f
+// runs, and Python calls made by f via the current Thread are executed by the
+// calling OS thread in the meantime.  Other Threads may also be used by f.  The
+// GIL must be held; it is held again when callGo returns.  A panic in f is
+// returned instead of being propagated.
+func callGo(f func(t *Thread)) (panicValue interface{}) {
+	t := currentThread()
+	queue := t.queue
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer func() {
+			panicValue = recover()
+		}()
+
+		f(t)
+	}()
+
+	threadState := C.PyEval_SaveThread()
+
+	for {
+		select {
+		case g, ok := <-queue:
+			if !ok {
+				queue = nil
+				continue
+			}
+
+			C.PyEval_RestoreThread(threadState)
+			g()
+			threadState = C.PyEval_SaveThread()
+
+		case <-done:
+			C.PyEval_RestoreThread(threadState)
+			return
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package python
+
+/*
+
+#include <Python.h>
+
+*/
+import "C"
+
+import (
+	"context"
+	"reflect"
+)
+
+func (o *object) Chan(ctx context.Context, t *Thread) (<-chan interface{}, <-chan error) {
+	values := make(chan interface{})
+	errs := make(chan error, 1)
+
+	go func() {
+		err := o.iterate(ctx, t, values)
+		close(values)
+		errs <- err
+		close(errs)
+	}()
+
+	return values, errs
+}
+
+func (o *object) iterate(ctx context.Context, t *Thread, values chan<- interface{}) (err error) {
+	var pyIter *C.PyObject
+
+	t.execute(func() {
+		if pyIter = C.PyObject_GetIter(o.pyObject); pyIter == nil {
+			err = getError()
+		}
+	})
+	if err != nil {
+		return
+	}
+
+	exhausted := false
+
+	defer t.execute(func() {
+		if !exhausted {
+			closeGenerator(pyIter)
+		}
+		C.Py_DecRef(pyIter)
+	})
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		var value interface{}
+
+		t.execute(func() {
+			pyItem := C.PyIter_Next(pyIter)
+			if pyItem == nil {
+				exhausted = true
+				if C.PyErr_Occurred() != nil {
+					err = getError()
+				}
+				return
+			}
+			defer C.Py_DecRef(pyItem)
+
+			value, err = decode(pyItem)
+		})
+		if exhausted || err != nil {
+			return
+		}
+
+		select {
+		case values <- value:
+
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+	}
+}
+
+// closeGenerator calls the close method of an iterator, if it has one.  Errors
+// are ignored.
+func closeGenerator(pyIter *C.PyObject) {
+	if pyClose, err := getAttr(pyIter, "close"); err == nil {
+		xDECREF(C.PyObject_CallObject(pyClose, nil))
+		C.Py_DecRef(pyClose)
+	}
+	C.PyErr_Clear()
+}
+
+// channel is the implementation of the go.Chan class, which is the Python
+// representation of Go channels.  It is an iterator which receives values
+// from the channel until it is closed.
+type channel struct {
+	c reflect.Value
+}
+
+var channelClass = internalClass{
+	name: "Chan",
+	typ:  reflect.TypeOf(channel{}),
+}
+
+// encodeChan translates a Go channel to a Python iterator.
+func encodeChan(c reflect.Value) (pyIter *C.PyObject, err error) {
+	if c.Type().ChanDir()&reflect.RecvDir == 0 {
+		err = typeError("unable to translate send-only %s to Python", c.Type())
+		return
+	}
+
+	if err = channelClass.define(); err != nil {
+		return
+	}
+
+	pyIter, _, err = newInstance(reflect.ValueOf(&channel{c}))
+	return
+}
+
+func (ch *channel) PyIter() *channel {
+	return ch
+}
+
+func (ch *channel) Next() (value interface{}, err error) {
+	if ch.c.IsNil() {
+		err = stopIteration
+		return
+	}
+
+	v, ok := ch.c.Recv()
+	if !ok {
+		err = stopIteration
+		return
+	}
+
+	value = v.Interface()
+	return
+}
@@ -0,0 +1,626 @@
+package python
+
+/*
+
+#include <Python.h>
+
+#include <stdint.h>
+#include <stdlib.h>
+
+extern void goRelease(uintptr_t handle);
+extern uintptr_t goNewInstance(void *type);
+extern void *goFunctionCall(uintptr_t handle, void *args, void *kwargs);
+
+// GoInstance is the base of Python classes defined in Go.  It refers to the Go
+// value via a handle.
+typedef struct {
+	PyObject_HEAD
+	uintptr_t handle;
+} GoInstance;
+
+static PyObject *GoInstance_new(PyTypeObject *type, PyObject *args, PyObject *kwargs) {
+	GoInstance *o;
+	uintptr_t handle;
+
+	handle = goNewInstance(type);
+	if (handle == 0) {
+		return NULL;
+	}
+
+	o = (GoInstance *) type->tp_alloc(type, 0);
+	if (o == NULL) {
+		goRelease(handle);
+		return NULL;
+	}
+
+	o->handle = handle;
+	return (PyObject *) o;
+}
+
+static void GoInstance_dealloc(PyObject *o) {
+	uintptr_t handle = ((GoInstance *) o)->handle;
+
+	if (handle) {
+		goRelease(handle);
+	}
+
+	Py_TYPE(o)->tp_free(o);
+}
+
+static PyObject *GoMethod_call(PyObject *o, PyObject *args, PyObject *kwargs) {
+	return goFunctionCall(((GoInstance *) o)->handle, args, kwargs);
+}
+
+// GoMethod_descr_get binds the method like a Python function.
+static PyObject *GoMethod_descr_get(PyObject *o, PyObject *obj, PyObject *type) {
+	if (obj == NULL || obj == Py_None) {
+		Py_INCREF(o);
+		return o;
+	}
+	return PyMethod_New(o, obj, type);
+}
+
+static void GoMethod_dealloc(PyObject *o) {
+	goRelease(((GoInstance *) o)->handle);
+	PyObject_Del(o);
+}
+
+static PyTypeObject GoInstanceType = {
+	PyVarObject_HEAD_INIT(NULL, 0)
+	"go.instance",
+	sizeof (GoInstance),
+	0,
+	GoInstance_dealloc,
+};
+
+static PyTypeObject GoMethodType = {
+	PyVarObject_HEAD_INIT(NULL, 0)
+	"go.method",
+	sizeof (GoInstance),
+	0,
+	GoMethod_dealloc,
+};
+
+static int initClassTypes(void) {
+	GoInstanceType.tp_new = GoInstance_new;
+	GoInstanceType.tp_flags = Py_TPFLAGS_DEFAULT | Py_TPFLAGS_BASETYPE;
+
+	if (PyType_Ready(&GoInstanceType) < 0) {
+		return -1;
+	}
+
+	GoMethodType.tp_call = GoMethod_call;
+	GoMethodType.tp_descr_get = GoMethod_descr_get;
+	GoMethodType.tp_flags = Py_TPFLAGS_DEFAULT;
+
+	return PyType_Ready(&GoMethodType);
+}
+
+static PyObject *GoMethod_New(uintptr_t handle) {
+	GoInstance *o = PyObject_New(GoInstance, &GoMethodType);
+	if (o) {
+		o->handle = handle;
+	}
+	return (PyObject *) o;
+}
+
+// GoInstance_Wrap creates an instance without calling __new__ or __init__.
+static PyObject *GoInstance_Wrap(PyObject *type, uintptr_t handle) {
+	PyTypeObject *t = (PyTypeObject *) type;
+	GoInstance *o = (GoInstance *) t->tp_alloc(t, 0);
+	if (o) {
+		o->handle = handle;
+	}
+	return (PyObject *) o;
+}
+
+static uintptr_t GoInstance_Handle(PyObject *o) {
+	if (PyObject_TypeCheck(o, &GoInstanceType)) {
+		return ((GoInstance *) o)->handle;
+	}
+	return 0;
+}
+
+static PyObject *Class_MRO(PyObject *type) {
+	return ((PyTypeObject *) type)->tp_mro;
+}
+
+static PyObject *Class_New(PyObject *name, PyObject *dict) {
+	PyObject *bases, *class;
+
+	bases = PyTuple_Pack(1, (PyObject *) &GoInstanceType);
+	if (bases == NULL) {
+		return NULL;
+	}
+
+	class = PyObject_CallFunctionObjArgs((PyObject *) &PyType_Type, name, bases, dict, NULL);
+	Py_DECREF(bases);
+	return class;
+}
+
+static PyObject *Property_New(PyObject *accessor, int readOnly, PyObject *doc) {
+	PyObject *setter = readOnly ? Py_None : accessor;
+
+	return PyObject_CallFunctionObjArgs((PyObject *) &PyProperty_Type, accessor, setter, Py_None, doc, NULL);
+}
+
+*/
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/cgo"
+	"strings"
+	"sync"
+	"unicode"
+	"unsafe"
+)
+
+func initClass() {
+	if C.initClassTypes() < 0 {
+		panic(getError())
+	}
+}
+
+// NewClass defines a Python class which is implemented by a Go struct type.
+// The prototype is a value of the struct type or a pointer to it.  Each
+// instance of the class (or its Python subclasses) owns a new Go value, and
+// decodes to a pointer to it.  Translating such a pointer to Python wraps it
+// in an instance of the class without calling __init__.
+//
+// Exported struct fields become properties.  Property names are taken from
+// the py struct field tags, or derived from the Go names by converting them to
+// lower case with underscores (FirstName becomes first_name).  Exported
+// methods of the pointer type become methods, and are named the same way.
+// Methods named like PyGetItem become special methods (__getitem__).  If
+// there is no PyInit method, __init__ accepts property values as keyword
+// arguments.
+//
+// Method parameters, results and errors are handled like those of proxied
+// functions.  See Proxy.
+//
+// A struct type can be defined as a class only once.
+func NewClass(t *Thread, name string, prototype interface{}) (class Object, err error) {
+	typ := reflect.TypeOf(prototype)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		err = fmt.Errorf("class prototype %T is not a struct", prototype)
+		return
+	}
+
+	t.execute(func() {
+		var pyClass *C.PyObject
+
+		if pyClass, err = newClass(name, typ, nil); err != nil {
+			return
+		}
+		defer C.Py_DecRef(pyClass)
+
+		class = newObject(pyClass)
+	})
+	return
+}
+
+var (
+	classLock  sync.RWMutex
+	classes    = make(map[reflect.Type]*C.PyObject) // kept forever
+	classTypes = make(map[*C.PyObject]reflect.Type)
+)
+
+// internalClass is defined on first use.
+type internalClass struct {
+	lock        sync.Mutex
+	defined     bool
+	name        string
+	typ         reflect.Type
+	methodNames map[string]string
+	readOnly    map[string]bool // keyed by Go field name
+}
+
+// define the class unless it has been defined already.  The lock isn't held
+// while Python code runs, so concurrent calls may build the class more than
+// once; the first one is kept.
+func (c *internalClass) define() (err error) {
+	c.lock.Lock()
+	defined := c.defined
+	c.lock.Unlock()
+
+	if defined {
+		return
+	}
+
+	pyClass, err := buildClass(c.name, c.typ, c.methodNames, c.readOnly)
+	if err != nil {
+		return
+	}
+	storeClass(c.typ, pyClass)
+	C.Py_DecRef(pyClass)
+
+	c.lock.Lock()
+	c.defined = true
+	c.lock.Unlock()
+	return
+}
+
+// instance is referenced by an instance of a class defined in Go.
+type instance struct {
+	v reflect.Value // pointer to struct
+}
+
+// method is referenced by a go.method object.
+type method struct {
+	name  string
+	typ   reflect.Type // pointer to struct
+	index int
+}
+
+// initializer is referenced by a go.method object which implements the
+// default __init__.
+type initializer struct {
+	name string
+	typ  reflect.Type // pointer to struct
+}
+
+// accessor is referenced by a go.function object which implements a
+// property.
+type accessor struct {
+	name  string
+	typ   reflect.Type // pointer to struct
+	index int
+}
+
+// newClass defines a class.  Python names of methods may be specified
+// explicitly (keyed by Go name).
+func newClass(name string, typ reflect.Type, methodNames map[string]string) (pyClass *C.PyObject, err error) {
+	classLock.RLock()
+	_, found := classes[typ]
+	classLock.RUnlock()
+
+	if !found {
+		if pyClass, err = buildClass(name, typ, methodNames, nil); err != nil {
+			return
+		}
+
+		if storeClass(typ, pyClass) {
+			return
+		}
+
+		C.Py_DecRef(pyClass)
+		pyClass = nil
+	}
+
+	err = fmt.Errorf("%s has already been defined as a Python class", typ)
+	return
+}
+
+// storeClass registers a class unless the type has one already.
+func storeClass(typ reflect.Type, pyClass *C.PyObject) bool {
+	classLock.Lock()
+	defer classLock.Unlock()
+
+	if _, found := classes[typ]; found {
+		return false
+	}
+
+	C.Py_IncRef(pyClass)
+	classes[typ] = pyClass
+	classTypes[pyClass] = typ
+	return true
+}
+
+// buildClass creates a class object without registering it.  Properties of
+// read-only fields can't be set by Python code.
+func buildClass(name string, typ reflect.Type, methodNames map[string]string, readOnly map[string]bool) (pyClass *C.PyObject, err error) {
+	pyDict := C.PyDict_New()
+	if pyDict == nil {
+		err = getError()
+		return
+	}
+	defer C.Py_DecRef(pyDict)
+
+	if err = setDictItem(pyDict, "__module__", encodeString("go")); err != nil {
+		return
+	}
+
+	if err = setDictItem(pyDict, "__slots__", C.PyTuple_New(0)); err != nil {
+		return
+	}
+
+	ptrType := reflect.PtrTo(typ)
+
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+
+		attr := f.Tag.Get("py")
+		switch attr {
+		case "-":
+			continue
+
+		case "":
+			attr = snakeCase(f.Name)
+		}
+
+		var pyAccessor *C.PyObject
+
+		if pyAccessor, err = newFunctionObject(&accessor{name + "." + attr, ptrType, i}); err != nil {
+			return
+		}
+
+		var cReadOnly C.int
+		if readOnly[f.Name] {
+			cReadOnly = 1
+		}
+
+		pyDoc := encodeString(f.Type.String())
+		pyProperty := C.Property_New(pyAccessor, cReadOnly, pyDoc)
+		C.Py_DecRef(pyDoc)
+		C.Py_DecRef(pyAccessor)
+
+		if err = setDictItem(pyDict, attr, pyProperty); err != nil {
+			return
+		}
+	}
+
+	hasInit := false
+
+	for i := 0; i < ptrType.NumMethod(); i++ {
+		attr := methodNames[ptrType.Method(i).Name]
+		if attr == "" {
+			attr = methodName(ptrType.Method(i).Name)
+		}
+		if attr == "__init__" {
+			hasInit = true
+		}
+
+		var pyMethod *C.PyObject
+
+		if pyMethod, err = newMethodObject(&method{name + "." + attr, ptrType, i}); err != nil {
+			return
+		}
+
+		if err = setDictItem(pyDict, attr, pyMethod); err != nil {
+			return
+		}
+	}
+
+	if !hasInit {
+		var pyInit *C.PyObject
+
+		if pyInit, err = newMethodObject(&initializer{name, ptrType}); err != nil {
+			return
+		}
+
+		if err = setDictItem(pyDict, "__init__", pyInit); err != nil {
+			return
+		}
+	}
+
+	pyName := encodeString(name)
+	if pyName == nil {
+		err = getError()
+		return
+	}
+	defer C.Py_DecRef(pyName)
+
+	if pyClass = C.Class_New(pyName, pyDict); pyClass == nil {
+		err = getError()
+	}
+	return
+}
+
+// setDictItem steals the value reference.
+func setDictItem(pyDict *C.PyObject, key string, pyValue *C.PyObject) (err error) {
+	if pyValue == nil {
+		return getError()
+	}
+	defer C.Py_DecRef(pyValue)
+
+	cKey := C.CString(key)
+	defer C.free(unsafe.Pointer(cKey))
+
+	if C.PyDict_SetItemString(pyDict, cKey, pyValue) < 0 {
+		err = getError()
+	}
+	return
+}
+
+func newMethodObject(x callable) (pyMethod *C.PyObject, err error) {
+	handle := cgo.NewHandle(x)
+
+	if pyMethod = C.GoMethod_New(C.uintptr_t(handle)); pyMethod == nil {
+		handle.Delete()
+		err = getError()
+	}
+	return
+}
+
+// methodName converts a Go method name to a Python attribute name.
+func methodName(name string) string {
+	if len(name) > 2 && strings.HasPrefix(name, "Py") && unicode.IsUpper(rune(name[2])) {
+		return "__" + strings.ToLower(name[2:]) + "__"
+	}
+	return snakeCase(name)
+}
+
+// snakeCase converts a Go name to lower case and separates words with
+// underscores.  Acronyms are treated as words: HTTPServer becomes http_server.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	buf := make([]rune, 0, len(runes)+4)
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				buf = append(buf, '_')
+			}
+		}
+		buf = append(buf, unicode.ToLower(r))
+	}
+
+	return string(buf)
+}
+
+// newInstance creates a Python instance for a Go value, or returns false if
+// its type has not been defined as a class.
+func newInstance(v reflect.Value) (pyInstance *C.PyObject, ok bool, err error) {
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+
+	classLock.RLock()
+	pyClass := classes[v.Type().Elem()]
+	classLock.RUnlock()
+
+	if pyClass == nil {
+		return
+	}
+
+	ok = true
+	handle := cgo.NewHandle(&instance{v})
+
+	if pyInstance = C.GoInstance_Wrap(pyClass, C.uintptr_t(handle)); pyInstance == nil {
+		handle.Delete()
+		err = getError()
+	}
+	return
+}
+
+// allocInstance creates a Go value for a new instance of a Python class, which
+// is defined in Go or derived from such a class.
+func allocInstance(pyClass *C.PyObject) (handle cgo.Handle, err error) {
+	classLock.RLock()
+	defer classLock.RUnlock()
+
+	pyMRO := C.Class_MRO(pyClass)
+
+	for i := C.Py_ssize_t(0); pyMRO != nil && i < C.PyTuple_Size(pyMRO); i++ {
+		if typ, found := classTypes[C.PyTuple_GetItem(pyMRO, i)]; found {
+			handle = cgo.NewHandle(&instance{reflect.New(typ)})
+			return
+		}
+	}
+
+	err = typeError("go.instance cannot be instantiated directly")
+	return
+}
+
+// decodeInstance gets the Go value of an instance.  The result is false if the
+// object is not an instance of a class defined in Go.
+func decodeInstance(pyValue *C.PyObject) (v reflect.Value, ok bool) {
+	if handle := C.GoInstance_Handle(pyValue); handle != 0 {
+		v = cgo.Handle(handle).Value().(*instance).v
+		ok = true
+	}
+	return
+}
+
+// receiver gets the Go value of the instance passed as the first argument.
+func receiver(pyArgs *C.PyObject, name string, typ reflect.Type) (v reflect.Value, err error) {
+	if C.PyTuple_Size(pyArgs) > 0 {
+		var ok bool
+
+		if v, ok = decodeInstance(C.PyTuple_GetItem(pyArgs, 0)); ok && v.Type() == typ {
+			return
+		}
+	}
+
+	err = typeError("%s must be called with a %s instance as first argument", name, typ)
+	return
+}
+
+// remainingArgs gets the arguments after the first one.
+func remainingArgs(pyArgs *C.PyObject) (pyRest *C.PyObject, err error) {
+	if pyRest = C.PyTuple_GetSlice(pyArgs, 1, C.PyTuple_Size(pyArgs)); pyRest == nil {
+		err = getError()
+	}
+	return
+}
+
+func (m *method) call(pyArgs, pyKwargs *C.PyObject) (pyResult *C.PyObject, err error) {
+	self, err := receiver(pyArgs, m.name, m.typ)
+	if err != nil {
+		return
+	}
+
+	pyRest, err := remainingArgs(pyArgs)
+	if err != nil {
+		return
+	}
+	defer C.Py_DecRef(pyRest)
+
+	return (&function{m.name, self.Method(m.index)}).call(pyRest, pyKwargs)
+}
+
+func (init *initializer) call(pyArgs, pyKwargs *C.PyObject) (pyResult *C.PyObject, err error) {
+	self, err := receiver(pyArgs, init.name+".__init__", init.typ)
+	if err != nil {
+		return
+	}
+
+	if C.PyTuple_Size(pyArgs) > 1 {
+		err = typeError("%s() takes only keyword arguments", init.name)
+		return
+	}
+
+	if pyKwargs != nil {
+		var (
+			pos     C.Py_ssize_t
+			pyKey   *C.PyObject
+			pyValue *C.PyObject
+		)
+
+		for C.PyDict_Next(pyKwargs, &pos, &pyKey, &pyValue) != 0 {
+			var name string
+
+			if name, err = attrName(pyKey); err != nil {
+				return
+			}
+
+			f, found := structFields(init.typ.Elem()).lookup(name)
+			if !found {
+				err = typeError("%s() got an unexpected keyword argument '%s'", init.name, name)
+				return
+			}
+
+			if err = decodeInto(pyValue, self.Elem().Field(f)); err != nil {
+				err = typeError("%s() argument '%s': %v", init.name, name, err)
+				return
+			}
+		}
+	}
+
+	return encode(nil)
+}
+
+// call gets the field value if there is one argument (the instance), or sets
+// it if there are two.
+func (a *accessor) call(pyArgs, pyKwargs *C.PyObject) (pyResult *C.PyObject, err error) {
+	self, err := receiver(pyArgs, a.name, a.typ)
+	if err != nil {
+		return
+	}
+
+	field := self.Elem().Field(a.index)
+
+	switch C.PyTuple_Size(pyArgs) {
+	case 1:
+		return proxyOrEncode(field)
+
+	case 2:
+		if err = decodeInto(C.PyTuple_GetItem(pyArgs, 1), field); err == nil {
+			pyResult, err = encode(nil)
+		}
+		return
+
+	default:
+		err = typeError("%s accessor called with wrong number of arguments", a.name)
+		return
+	}
+}
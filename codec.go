@@ -0,0 +1,814 @@
+package python
+
+/*
+
+#include <Python.h>
+
+static PyObject *Type_MRO(PyObject *o) {
+	return Py_TYPE(o)->tp_mro;
+}
+
+// builtinValue checks if the object is an instance of a built-in type which
+// is translated without consulting registered decoders.
+static int builtinValue(PyObject *o) {
+	PyTypeObject *t = Py_TYPE(o);
+
+	return t == &PyString_Type ||
+	       t == &PyUnicode_Type ||
+	       t == &PyInt_Type ||
+	       t == &PyLong_Type ||
+	       t == &PyFloat_Type ||
+	       t == &PyComplex_Type ||
+	       t == &PyByteArray_Type ||
+	       t == &PyTuple_Type ||
+	       t == &PyList_Type ||
+	       t == &PyDict_Type ||
+	       t == &PySet_Type ||
+	       t == &PyFrozenSet_Type;
+}
+
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Marshaler is implemented by Go types which translate themselves to Python.
+// The returned value is translated in turn; it may be an Object.
+type Marshaler interface {
+	MarshalPython() (interface{}, error)
+}
+
+// Unmarshaler is implemented by Go types which translate themselves from
+// Python.  It is used by the Unmarshal method of Object.
+type Unmarshaler interface {
+	UnmarshalPython(o Object) error
+}
+
+// Decoder translates an instance of a Python class to a Go value.
+type Decoder func(o Object) (interface{}, error)
+
+type registeredDecoder struct {
+	class   *object // keeps the Python class alive
+	decoder Decoder
+}
+
+var (
+	decoderLock sync.RWMutex
+	decoders    = make(map[*C.PyObject]registeredDecoder)
+)
+
+// RegisterDecoder makes instances of a Python class (or its subclasses) be
+// translated to Go values by a function.  The class must be a new-style class.
+// A nil decoder unregisters the class.  Decoders are not used for instances of
+// the built-in str, unicode, int, long, float, complex, bytearray, tuple, list,
+// dict, set and frozenset types (subclass instances are not exempt).
+//
+// The function may call Python using any Thread, including the one which is
+// translating the value.
+func RegisterDecoder(class Object, decoder Decoder) (err error) {
+	o, ok := class.(*object)
+	if !ok {
+		err = errors.New("decoder class is not a Python object")
+		return
+	}
+
+	decoderLock.Lock()
+	defer decoderLock.Unlock()
+
+	if decoder == nil {
+		delete(decoders, o.pyObject)
+	} else {
+		decoders[o.pyObject] = registeredDecoder{o, decoder}
+	}
+	return
+}
+
+// findDecoder looks up a registered decoder for the type of a Python object or
+// its base types.
+func findDecoder(pyValue *C.PyObject) (decoder Decoder) {
+	if C.builtinValue(pyValue) != 0 {
+		return
+	}
+
+	decoderLock.RLock()
+	defer decoderLock.RUnlock()
+
+	if len(decoders) == 0 {
+		return
+	}
+
+	pyMRO := C.Type_MRO(pyValue)
+	if pyMRO == nil {
+		return
+	}
+
+	for i := C.Py_ssize_t(0); i < C.PyTuple_Size(pyMRO); i++ {
+		if r, found := decoders[C.PyTuple_GetItem(pyMRO, i)]; found {
+			decoder = r.decoder
+			return
+		}
+	}
+	return
+}
+
+// decodeRegistered translates a Python object using a registered decoder.
+// The result is false if there is no decoder for the type.
+func decodeRegistered(pyValue *C.PyObject) (value interface{}, ok bool, err error) {
+	decoder := findDecoder(pyValue)
+	if decoder == nil {
+		return
+	}
+
+	ok = true
+	o := newObject(pyValue)
+
+	if p := callGo(func(*Thread) {
+		value, err = decoder(o)
+	}); p != nil {
+		panic(p)
+	}
+	return
+}
+
+// maxMarshalDepth limits the number of Marshalers returned by Marshalers, so
+// that a Marshaler which returns itself (or a cycle of them) is detected.
+const maxMarshalDepth = 100
+
+// encodeMarshaler translates a Go value to a Python object via its
+// MarshalPython method.
+func encodeMarshaler(m Marshaler) (pyValue *C.PyObject, err error) {
+	first := m
+
+	for depth := 0; ; depth++ {
+		var x interface{}
+
+		if p := callGo(func(*Thread) {
+			x, err = m.MarshalPython()
+		}); p != nil {
+			panic(p)
+		}
+		if err != nil {
+			return
+		}
+
+		next, ok := x.(Marshaler)
+		if !ok {
+			return encode(x)
+		}
+		if depth == maxMarshalDepth {
+			err = fmt.Errorf("%T.MarshalPython: Marshalers nested too deeply", first)
+			return
+		}
+
+		m = next
+	}
+}
+
+func (o *object) Unmarshal(t *Thread, v interface{}) (err error) {
+	if u, ok := v.(Unmarshaler); ok {
+		return u.UnmarshalPython(o)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		err = fmt.Errorf("unable to unmarshal Python object into %T", v)
+		return
+	}
+
+	t.execute(func() {
+		err = decodeInto(o.pyObject, rv.Elem())
+	})
+	return
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+// decodeInto translates a Python object to a Go value of a specific type.
+func decodeInto(pyValue *C.PyObject, rv reflect.Value) (err error) {
+	if rv.CanAddr() && rv.Addr().Type().Implements(unmarshalerType) {
+		u := rv.Addr().Interface().(Unmarshaler)
+		o := newObject(pyValue)
+
+		if p := callGo(func(*Thread) {
+			err = u.UnmarshalPython(o)
+		}); p != nil {
+			panic(p)
+		}
+		return
+	}
+
+	if v, ok := decodeProxy(pyValue); ok && v.Type().AssignableTo(rv.Type()) {
+		rv.Set(v)
+		return
+	}
+
+	if rv.Type() == objectType {
+		if o := newObject(pyValue); o != nil {
+			rv.Set(reflect.ValueOf(o))
+		} else {
+			rv.Set(reflect.Zero(objectType))
+		}
+		return
+	}
+
+	pyType := typeOf(pyValue)
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if pyType == 1 {
+			rv.Set(reflect.Zero(rv.Type()))
+			return
+		}
+
+		elem := reflect.New(rv.Type().Elem())
+		if err = decodeInto(pyValue, elem.Elem()); err == nil {
+			rv.Set(elem)
+		}
+		return
+
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() != reflect.Uint8 && pyType != 4 && pyType != 11 && pyType != 12 && C.PySequence_Check(pyValue) != 0 {
+			return decodeSliceInto(pyValue, rv)
+		}
+
+	case reflect.Map:
+		if pyType == 10 {
+			return decodeMapInto(pyValue, rv)
+		}
+
+	case reflect.Struct:
+		if rv.Type() == bigIntType && (pyType == 5 || pyType == 6) {
+			return decodeBigIntInto(pyValue, pyType, rv)
+		}
+
+		if pyType > 3 && rv.Type() != timeType && rv.Type() != dateType && rv.Type() != timeOfDayType && rv.Type() != bigIntType {
+			return decodeStructInto(pyValue, pyType, rv)
+		}
+	}
+
+	value, err := decode(pyValue)
+	if err != nil {
+		return
+	}
+
+	return assign(rv, value)
+}
+
+// decodeBigIntInto translates a Python int or long to a big.Int.
+func decodeBigIntInto(pyValue *C.PyObject, pyType C.int, rv reflect.Value) (err error) {
+	var i *big.Int
+
+	if pyType == 5 {
+		i = big.NewInt(int64(C.PyInt_AsLong(pyValue)))
+	} else if i, err = decodeBigInt(pyValue); err != nil {
+		return
+	}
+
+	rv.Set(reflect.ValueOf(i).Elem())
+	return
+}
+
+// decodeSliceInto translates a Python sequence to a Go slice.
+func decodeSliceInto(pySequence *C.PyObject, rv reflect.Value) (err error) {
+	length := int(C.PySequence_Size(pySequence))
+	if length < 0 {
+		return getError()
+	}
+
+	slice := reflect.MakeSlice(rv.Type(), length, length)
+
+	for i := 0; i < length; i++ {
+		pyItem := C.PySequence_GetItem(pySequence, C.Py_ssize_t(i))
+		if pyItem == nil {
+			return getError()
+		}
+
+		err = decodeInto(pyItem, slice.Index(i))
+		C.Py_DecRef(pyItem)
+		if err != nil {
+			return
+		}
+	}
+
+	rv.Set(slice)
+	return
+}
+
+// decodeMapInto translates a Python mapping to a Go map.
+func decodeMapInto(pyMapping *C.PyObject, rv reflect.Value) (err error) {
+	pyItems := mappingItems(pyMapping)
+	if pyItems == nil {
+		return getError()
+	}
+	defer C.Py_DecRef(pyItems)
+
+	length := int(C.PySequence_Size(pyItems))
+	if length < 0 {
+		return getError()
+	}
+
+	m := reflect.MakeMap(rv.Type())
+	keyType := rv.Type().Key()
+	elemType := rv.Type().Elem()
+
+	for i := 0; i < length; i++ {
+		pyPair := C.PySequence_GetItem(pyItems, C.Py_ssize_t(i))
+		if pyPair == nil {
+			return getError()
+		}
+
+		key := reflect.New(keyType).Elem()
+		elem := reflect.New(elemType).Elem()
+
+		err = decodePairInto(pyPair, key, elem)
+		C.Py_DecRef(pyPair)
+		if err != nil {
+			return
+		}
+
+		m.SetMapIndex(key, elem)
+	}
+
+	rv.Set(m)
+	return
+}
+
+func decodePairInto(pyPair *C.PyObject, key, elem reflect.Value) (err error) {
+	pyKey, pyElem, err := unpackPair(pyPair)
+	if err != nil {
+		return
+	}
+
+	if err = decodeInto(pyKey, key); err != nil {
+		return
+	}
+
+	return decodeInto(pyElem, elem)
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	dateType      = reflect.TypeOf(Date{})
+	timeOfDayType = reflect.TypeOf(TimeOfDay{})
+)
+
+// decodeStructInto translates a Python dict, namedtuple or other object to a
+// Go struct.  The dict's items, the namedtuple's fields or the object's
+// attributes are matched with exported struct fields by the "py" tag, or by
+// name ignoring case and underscores.  Unmatched fields are left untouched.
+func decodeStructInto(pyValue *C.PyObject, pyType C.int, rv reflect.Value) (err error) {
+	fields := structFields(rv.Type())
+
+	if pyType == 10 {
+		return decodeStructFromMapping(pyValue, rv, fields)
+	}
+
+	var pyDict *C.PyObject
+
+	// namedtuple converts itself to a dict; other objects have one.
+	switch {
+	case C.PyObject_HasAttrString(pyValue, cAsDict) != 0:
+		if _, pyDict, err = call(pyValue, "_asdict", nil); err != nil {
+			return
+		}
+
+	case C.PyObject_HasAttrString(pyValue, cDict) != 0:
+		if pyDict, err = getAttr(pyValue, "__dict__"); err != nil {
+			return
+		}
+
+	default:
+		err = fmt.Errorf("unable to unmarshal Python %s object into %s", C.GoString(pyValue.ob_type.tp_name), rv.Type())
+		return
+	}
+	defer C.Py_DecRef(pyDict)
+
+	return decodeStructFromMapping(pyDict, rv, fields)
+}
+
+var (
+	cAsDict = C.CString("_asdict")
+	cDict   = C.CString("__dict__")
+)
+
+func decodeStructFromMapping(pyMapping *C.PyObject, rv reflect.Value, fields fieldMap) (err error) {
+	pyItems := mappingItems(pyMapping)
+	if pyItems == nil {
+		return getError()
+	}
+	defer C.Py_DecRef(pyItems)
+
+	length := int(C.PySequence_Size(pyItems))
+	if length < 0 {
+		return getError()
+	}
+
+	for i := 0; i < length; i++ {
+		pyPair := C.PySequence_GetItem(pyItems, C.Py_ssize_t(i))
+		if pyPair == nil {
+			return getError()
+		}
+
+		err = decodeFieldFromPair(pyPair, rv, fields)
+		C.Py_DecRef(pyPair)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func decodeFieldFromPair(pyPair *C.PyObject, rv reflect.Value, fields fieldMap) (err error) {
+	pyKey, pyValue, err := unpackPair(pyPair)
+	if err != nil {
+		return
+	}
+
+	key, err := decode(pyKey)
+	if err != nil {
+		return
+	}
+
+	name, ok := key.(string)
+	if !ok {
+		return
+	}
+
+	i, found := fields.lookup(name)
+	if !found {
+		return
+	}
+
+	if err = decodeInto(pyValue, rv.Field(i)); err != nil {
+		err = fmt.Errorf("%s.%s: %v", rv.Type(), rv.Type().Field(i).Name, err)
+	}
+	return
+}
+
+// fieldMap finds struct field indexes by Python names.
+type fieldMap struct {
+	tagged     map[string]int
+	normalized map[string]int
+}
+
+func structFields(t reflect.Type) (m fieldMap) {
+	m.tagged = make(map[string]int)
+	m.normalized = make(map[string]int)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+
+		switch tag := f.Tag.Get("py"); tag {
+		case "-":
+
+		case "":
+			m.normalized[normalizeName(f.Name)] = i
+
+		default:
+			m.tagged[tag] = i
+		}
+	}
+	return
+}
+
+func (m fieldMap) lookup(name string) (i int, found bool) {
+	if i, found = m.tagged[name]; !found {
+		i, found = m.normalized[normalizeName(name)]
+	}
+	return
+}
+
+// normalizeName converts to lower case and removes underscores.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "", -1))
+}
+
+// assign a decoded Go value to a typed Go value.  Numeric values may be
+// converted to other numeric types, and strings to byte slices and vice versa.
+func assign(rv reflect.Value, value interface{}) (err error) {
+	if value == nil {
+		switch rv.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map:
+			rv.Set(reflect.Zero(rv.Type()))
+			return
+		}
+	} else {
+		v := reflect.ValueOf(value)
+
+		if v.Type().AssignableTo(rv.Type()) {
+			rv.Set(v)
+			return
+		}
+
+		if convertible(v.Kind(), rv.Kind(), rv.Type()) && v.Type().ConvertibleTo(rv.Type()) {
+			c := v.Convert(rv.Type())
+
+			if isNumeric(v.Kind()) && !preserved(v, c) {
+				err = fmt.Errorf("Python value %v does not fit in %s", value, rv.Type())
+				return
+			}
+
+			rv.Set(c)
+			return
+		}
+	}
+
+	err = fmt.Errorf("unable to assign Python value of Go type %T to %s", value, rv.Type())
+	return
+}
+
+// preserved checks that a numeric conversion didn't change the value.  Floating
+// point values may lose precision, but they may not overflow.
+func preserved(v, c reflect.Value) bool {
+	switch {
+	case isFloat(v.Kind()) && isFloat(c.Kind()):
+		return math.IsInf(c.Float(), 0) == math.IsInf(v.Float(), 0)
+
+	case isComplex(v.Kind()) && isComplex(c.Kind()):
+		x, y := v.Complex(), c.Complex()
+		return math.IsInf(real(y), 0) == math.IsInf(real(x), 0) && math.IsInf(imag(y), 0) == math.IsInf(imag(x), 0)
+	}
+
+	return c.Convert(v.Type()).Interface() == v.Interface()
+}
+
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+func isComplex(k reflect.Kind) bool {
+	return k == reflect.Complex64 || k == reflect.Complex128
+}
+
+func convertible(from, to reflect.Kind, toType reflect.Type) bool {
+	switch {
+	case isNumeric(from):
+		return isNumeric(to)
+
+	case from == reflect.String:
+		return to == reflect.String || (to == reflect.Slice && toType.Elem().Kind() == reflect.Uint8)
+
+	case from == reflect.Slice:
+		return to == reflect.String || to == reflect.Slice
+
+	case from == reflect.Map:
+		return to == reflect.Map
+	}
+
+	return false
+}
+
+func isNumeric(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Complex128
+}
+
+// encodeReflect translates Go values which are not handled by encode's type
+// switch.  Struct fields are named after their "py" tags, or Go field names if
+// not tagged.  Fields tagged with "-" and unexported fields are skipped.
+func encodeReflect(v reflect.Value) (pyValue *C.PyObject, err error) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return encode(nil)
+		}
+		if pyInstance, ok, err := newInstance(v); ok {
+			return pyInstance, err
+		}
+		if v.Kind() == reflect.Ptr {
+			return encodeShared(v, func() (*C.PyObject, error) {
+				return encode(v.Elem().Interface())
+			})
+		}
+		return encode(v.Elem().Interface())
+
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String:
+		// Named type.
+		return encode(v.Convert(basicTypes[v.Kind()]).Interface())
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return encode(nil)
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Named byte slice or byte array.
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return encode(b)
+		}
+
+		encodeArray := func() (*C.PyObject, error) {
+			array := make([]interface{}, v.Len())
+			for i := range array {
+				array[i] = v.Index(i).Interface()
+			}
+			return encode(array)
+		}
+
+		if v.Kind() == reflect.Slice {
+			return encodeShared(v, encodeArray)
+		}
+		return encodeArray()
+
+	case reflect.Map:
+		if v.IsNil() {
+			return encode(nil)
+		}
+
+		return encodeShared(v, func() (*C.PyObject, error) {
+			m := make(map[interface{}]interface{}, v.Len())
+			for _, key := range v.MapKeys() {
+				m[key.Interface()] = v.MapIndex(key).Interface()
+			}
+			return encodeDict(m)
+		})
+
+	case reflect.Struct:
+		return encodeStruct(v)
+
+	case reflect.Chan:
+		return encodeChan(v)
+	}
+
+	err = fmt.Errorf("unable to translate %T to Python", v.Interface())
+	return
+}
+
+// encodingPointers contains the pointers, maps and slices which are being
+// translated on each Python thread, for detecting cycles.  It is accessed with
+// the GIL held.
+var encodingPointers = make(map[*C.PyThreadState]map[encodingPointer]struct{})
+
+type encodingPointer struct {
+	t reflect.Type
+	p uintptr
+}
+
+// encodeShared calls f to translate a non-nil pointer, map or slice, unless
+// the same reference is already being translated (i.e. it contains itself).
+func encodeShared(v reflect.Value, f func() (*C.PyObject, error)) (pyValue *C.PyObject, err error) {
+	if v.Kind() == reflect.Slice && v.Len() == 0 {
+		return f() // Empty slices may share a pointer.
+	}
+
+	threadState := C.PyThreadState_Get()
+
+	active := encodingPointers[threadState]
+	if active == nil {
+		active = make(map[encodingPointer]struct{})
+		encodingPointers[threadState] = active
+		defer delete(encodingPointers, threadState)
+	}
+
+	key := encodingPointer{v.Type(), v.Pointer()}
+	if _, found := active[key]; found {
+		err = fmt.Errorf("unable to translate %s to Python: circular reference", v.Type())
+		return
+	}
+
+	active[key] = struct{}{}
+	defer delete(active, key)
+
+	return f()
+}
+
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:       reflect.TypeOf(false),
+	reflect.Int:        reflect.TypeOf(int(0)),
+	reflect.Int8:       reflect.TypeOf(int8(0)),
+	reflect.Int16:      reflect.TypeOf(int16(0)),
+	reflect.Int32:      reflect.TypeOf(int32(0)),
+	reflect.Int64:      reflect.TypeOf(int64(0)),
+	reflect.Uint:       reflect.TypeOf(uint(0)),
+	reflect.Uint8:      reflect.TypeOf(uint8(0)),
+	reflect.Uint16:     reflect.TypeOf(uint16(0)),
+	reflect.Uint32:     reflect.TypeOf(uint32(0)),
+	reflect.Uint64:     reflect.TypeOf(uint64(0)),
+	reflect.Uintptr:    reflect.TypeOf(uintptr(0)),
+	reflect.Float32:    reflect.TypeOf(float32(0)),
+	reflect.Float64:    reflect.TypeOf(float64(0)),
+	reflect.Complex64:  reflect.TypeOf(complex64(0)),
+	reflect.Complex128: reflect.TypeOf(complex128(0)),
+	reflect.String:     reflect.TypeOf(""),
+}
+
+// encodeStruct translates a Go struct to a Python dict or namedtuple.
+func encodeStruct(v reflect.Value) (pyValue *C.PyObject, err error) {
+	fields := encodedFields(v.Type())
+
+	if !StructObjects {
+		m := make(map[interface{}]interface{}, len(fields))
+		for _, f := range fields {
+			m[f.name] = v.Field(f.index).Interface()
+		}
+		return encodeDict(m)
+	}
+
+	pyClass, err := namedtupleClass(v.Type(), fields)
+	if err != nil {
+		return
+	}
+
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		values[i] = v.Field(f.index).Interface()
+	}
+
+	pyType, pyValue, err := invoke(pyClass, values)
+	if err == nil && pyType <= 3 {
+		err = fmt.Errorf("namedtuple class of %s returned %s", v.Type(), stringify(pyClass))
+	}
+	return
+}
+
+type encodedField struct {
+	name  string
+	index int
+}
+
+func encodedFields(t reflect.Type) (fields []encodedField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+
+		name := f.Tag.Get("py")
+		switch name {
+		case "-":
+			continue
+
+		case "":
+			name = f.Name
+		}
+
+		fields = append(fields, encodedField{name, i})
+	}
+	return
+}
+
+var (
+	namedtupleLock    sync.Mutex
+	namedtupleClasses = make(map[reflect.Type]*C.PyObject)
+)
+
+// namedtupleClass gets a namedtuple class for a struct type.  Classes are
+// created on demand and kept forever.
+func namedtupleClass(t reflect.Type, fields []encodedField) (pyClass *C.PyObject, err error) {
+	namedtupleLock.Lock()
+	pyClass = namedtupleClasses[t]
+	namedtupleLock.Unlock()
+
+	if pyClass != nil {
+		return
+	}
+
+	// The lock isn't held while Python code runs, as it may release the GIL.
+
+	pyModule, err := importModule("collections")
+	if err != nil {
+		return
+	}
+	defer C.Py_DecRef(pyModule)
+
+	name := t.Name()
+	if name == "" {
+		name = "struct"
+	}
+
+	names := make([]interface{}, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+
+	_, pyNewClass, err := call(pyModule, "namedtuple", []interface{}{name, List(names)})
+	if err != nil {
+		return
+	}
+
+	// Another thread may have created a class in the meantime.
+	namedtupleLock.Lock()
+	if pyClass = namedtupleClasses[t]; pyClass == nil {
+		pyClass = pyNewClass
+		namedtupleClasses[t] = pyClass
+	}
+	namedtupleLock.Unlock()
+
+	if pyClass != pyNewClass {
+		C.Py_DecRef(pyNewClass)
+	}
+	return
+}
@@ -0,0 +1,364 @@
+package python
+
+/*
+
+#include <Python.h>
+#include <datetime.h>
+
+static int importDateTime(void) {
+	if (PyDateTimeAPI == NULL) {
+		PyDateTime_IMPORT;
+		if (PyDateTimeAPI == NULL) {
+			return -1;
+		}
+	}
+	return 0;
+}
+
+static PyObject *FixedOffset_New(PyObject *class, PyObject *offset, PyObject *name) {
+	return PyObject_CallFunctionObjArgs(class, offset, name, NULL);
+}
+
+static int isDateTime(PyObject *o) {
+	return PyDateTime_Check(o);
+}
+
+static int isDate(PyObject *o) {
+	return PyDate_Check(o);
+}
+
+static int isTime(PyObject *o) {
+	return PyTime_Check(o);
+}
+
+static int isDelta(PyObject *o) {
+	return PyDelta_Check(o);
+}
+
+// DateTime_New creates a naive datetime object if tzinfo is NULL.
+static PyObject *DateTime_New(int year, int month, int day, int hour, int minute, int second, int usecond, PyObject *tzinfo) {
+	if (tzinfo == NULL) {
+		tzinfo = Py_None;
+	}
+	return PyDateTimeAPI->DateTime_FromDateAndTime(year, month, day, hour, minute, second, usecond, tzinfo, PyDateTimeAPI->DateTimeType);
+}
+
+static PyObject *Date_New(int year, int month, int day) {
+	return PyDate_FromDate(year, month, day);
+}
+
+// Time_New creates a naive time object if tzinfo is NULL.
+static PyObject *Time_New(int hour, int minute, int second, int usecond, PyObject *tzinfo) {
+	if (tzinfo == NULL) {
+		tzinfo = Py_None;
+	}
+	return PyDateTimeAPI->Time_FromTime(hour, minute, second, usecond, tzinfo, PyDateTimeAPI->TimeType);
+}
+
+static PyObject *Delta_New(int days, int seconds, int useconds) {
+	return PyDelta_FromDSU(days, seconds, useconds);
+}
+
+static void Date_Get(PyObject *o, int *year, int *month, int *day) {
+	*year = PyDateTime_GET_YEAR(o);
+	*month = PyDateTime_GET_MONTH(o);
+	*day = PyDateTime_GET_DAY(o);
+}
+
+static void DateTime_GetTime(PyObject *o, int *hour, int *minute, int *second, int *usecond) {
+	*hour = PyDateTime_DATE_GET_HOUR(o);
+	*minute = PyDateTime_DATE_GET_MINUTE(o);
+	*second = PyDateTime_DATE_GET_SECOND(o);
+	*usecond = PyDateTime_DATE_GET_MICROSECOND(o);
+}
+
+static void Time_Get(PyObject *o, int *hour, int *minute, int *second, int *usecond) {
+	*hour = PyDateTime_TIME_GET_HOUR(o);
+	*minute = PyDateTime_TIME_GET_MINUTE(o);
+	*second = PyDateTime_TIME_GET_SECOND(o);
+	*usecond = PyDateTime_TIME_GET_MICROSECOND(o);
+}
+
+static void Delta_Get(PyObject *o, int *days, int *seconds, int *useconds) {
+	PyDateTime_Delta *d = (PyDateTime_Delta *) o;
+
+	*days = d->days;
+	*seconds = d->seconds;
+	*useconds = d->microseconds;
+}
+
+*/
+import "C"
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/tsavola/go-python/internal/types"
+)
+
+// Date is translated to and from Python's datetime.date type.
+type Date = types.Date
+
+// TimeOfDay is translated to and from Python's datetime.time type.  Location
+// is nil for naive time objects.  An aware time object gets the UTC offset
+// which the location has at the moment of translation.
+type TimeOfDay = types.TimeOfDay
+
+const fixedOffsetSource = `
+import datetime
+
+class FixedOffset(datetime.tzinfo):
+	__slots__ = ('_offset', '_name')
+
+	def __init__(self, offset, name=None):
+		self._offset = offset
+		self._name = name
+
+	def utcoffset(self, dt):
+		return self._offset
+
+	def dst(self, dt):
+		return datetime.timedelta(0)
+
+	def tzname(self, dt):
+		return self._name
+
+	def __repr__(self):
+		return 'FixedOffset(%r, %r)' % (self._offset, self._name)
+`
+
+// fixedOffsetClass is a tzinfo implementation used for aware Go values.
+var fixedOffsetClass = lazyClass{source: fixedOffsetSource, name: "FixedOffset"}
+
+func importDateTime() (err error) {
+	if C.importDateTime() < 0 {
+		err = getError()
+	}
+	return
+}
+
+// encodeDateTime translates a Go time to an aware Python datetime object.
+// Precision is truncated to microseconds.
+func encodeDateTime(t time.Time) (pyDateTime *C.PyObject, err error) {
+	if err = importDateTime(); err != nil {
+		return
+	}
+
+	pyTZInfo, err := encodeTZInfo(t.Zone())
+	if err != nil {
+		return
+	}
+	defer C.Py_DecRef(pyTZInfo)
+
+	year, month, day := t.Date()
+	hour, minute, second := t.Clock()
+	usecond := t.Nanosecond() / 1000
+
+	if pyDateTime = C.DateTime_New(C.int(year), C.int(month), C.int(day), C.int(hour), C.int(minute), C.int(second), C.int(usecond), pyTZInfo); pyDateTime == nil {
+		err = getError()
+	}
+	return
+}
+
+// encodeDate translates a Go date to a Python date object.
+func encodeDate(d Date) (pyDate *C.PyObject, err error) {
+	if err = importDateTime(); err != nil {
+		return
+	}
+
+	if pyDate = C.Date_New(C.int(d.Year), C.int(d.Month), C.int(d.Day)); pyDate == nil {
+		err = getError()
+	}
+	return
+}
+
+// encodeTime translates a Go time of day to a Python time object.
+func encodeTime(t TimeOfDay) (pyTime *C.PyObject, err error) {
+	if err = importDateTime(); err != nil {
+		return
+	}
+
+	var pyTZInfo *C.PyObject
+
+	if t.Location != nil {
+		if pyTZInfo, err = encodeTZInfo(time.Now().In(t.Location).Zone()); err != nil {
+			return
+		}
+		defer C.Py_DecRef(pyTZInfo)
+	}
+
+	if pyTime = C.Time_New(C.int(t.Hour), C.int(t.Minute), C.int(t.Second), C.int(t.Microsecond), pyTZInfo); pyTime == nil {
+		err = getError()
+	}
+	return
+}
+
+// encodeTZInfo creates a Python tzinfo object for a fixed UTC offset.
+func encodeTZInfo(name string, offset int) (pyTZInfo *C.PyObject, err error) {
+	pyClass, err := fixedOffsetClass.get()
+	if err != nil {
+		return
+	}
+
+	pyOffset, err := encodeTimedelta(time.Duration(offset) * time.Second)
+	if err != nil {
+		return
+	}
+	defer C.Py_DecRef(pyOffset)
+
+	pyName := encodeString(name)
+	if pyName == nil {
+		err = getError()
+		return
+	}
+	defer C.Py_DecRef(pyName)
+
+	if pyTZInfo = C.FixedOffset_New(pyClass, pyOffset, pyName); pyTZInfo == nil {
+		err = getError()
+	}
+	return
+}
+
+// encodeTimedelta translates a Go duration to a Python timedelta object.
+// Precision is truncated to microseconds.
+func encodeTimedelta(d time.Duration) (pyDelta *C.PyObject, err error) {
+	if err = importDateTime(); err != nil {
+		return
+	}
+
+	days := d / (24 * time.Hour)
+	seconds := (d % (24 * time.Hour)) / time.Second
+	useconds := (d % time.Second) / time.Microsecond
+
+	if pyDelta = C.Delta_New(C.int(days), C.int(seconds), C.int(useconds)); pyDelta == nil {
+		err = getError()
+	}
+	return
+}
+
+// decodeDateTimeType translates a Python datetime, date, time or timedelta
+// object to a Go value.  The result is false if the object has some other
+// type.
+func decodeDateTimeType(pyValue *C.PyObject) (value interface{}, ok bool, err error) {
+	if err = importDateTime(); err != nil {
+		return
+	}
+
+	ok = true
+
+	switch {
+	case C.isDateTime(pyValue) != 0:
+		value, err = decodeDateTime(pyValue)
+
+	case C.isDate(pyValue) != 0:
+		var year, month, day C.int
+		C.Date_Get(pyValue, &year, &month, &day)
+		value = Date{Year: int(year), Month: time.Month(month), Day: int(day)}
+
+	case C.isTime(pyValue) != 0:
+		var hour, minute, second, usecond C.int
+		C.Time_Get(pyValue, &hour, &minute, &second, &usecond)
+
+		t := TimeOfDay{
+			Hour:        int(hour),
+			Minute:      int(minute),
+			Second:      int(second),
+			Microsecond: int(usecond),
+		}
+
+		t.Location, err = decodeLocation(pyValue)
+		value = t
+
+	case C.isDelta(pyValue) != 0:
+		value, err = decodeTimedelta(pyValue)
+
+	default:
+		ok = false
+	}
+	return
+}
+
+// decodeDateTime translates a Python datetime object to a Go time.  Naive
+// datetime objects are interpreted in the local time zone.
+func decodeDateTime(pyDateTime *C.PyObject) (t time.Time, err error) {
+	var year, month, day, hour, minute, second, usecond C.int
+
+	C.Date_Get(pyDateTime, &year, &month, &day)
+	C.DateTime_GetTime(pyDateTime, &hour, &minute, &second, &usecond)
+
+	loc, err := decodeLocation(pyDateTime)
+	if err != nil {
+		return
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	t = time.Date(int(year), time.Month(month), int(day), int(hour), int(minute), int(second), int(usecond)*1000, loc)
+	return
+}
+
+// decodeLocation gets a fixed time zone of an aware datetime or time object,
+// or nil if the object is naive.
+func decodeLocation(pyValue *C.PyObject) (loc *time.Location, err error) {
+	pyType, pyOffset, err := call(pyValue, "utcoffset", nil)
+	if err != nil || pyType == 1 {
+		return
+	}
+	defer xDECREF(pyOffset)
+
+	if C.isDelta(pyOffset) == 0 {
+		err = fmt.Errorf("utcoffset() returned %s", stringify(pyOffset))
+		return
+	}
+
+	offset, err := decodeTimedelta(pyOffset)
+	if err != nil {
+		return
+	}
+
+	pyType, pyName, err := call(pyValue, "tzname", nil)
+	if err != nil {
+		return
+	}
+	defer xDECREF(pyName)
+
+	name, _ := decodeType(pyType, pyName)
+	zone, _ := name.(string)
+
+	if offset == 0 && (zone == "" || zone == "UTC") {
+		loc = time.UTC
+	} else {
+		loc = time.FixedZone(zone, int(offset/time.Second))
+	}
+	return
+}
+
+// decodeTimedelta translates a Python timedelta object to a Go duration.
+func decodeTimedelta(pyDelta *C.PyObject) (d time.Duration, err error) {
+	var days, seconds, useconds C.int
+	C.Delta_Get(pyDelta, &days, &seconds, &useconds)
+
+	total := new(big.Int)
+
+	for _, part := range [...]struct {
+		n    C.int
+		unit time.Duration
+	}{
+		{days, 24 * time.Hour},
+		{seconds, time.Second},
+		{useconds, time.Microsecond},
+	} {
+		total.Add(total, new(big.Int).Mul(big.NewInt(int64(part.n)), big.NewInt(int64(part.unit))))
+	}
+
+	if !total.IsInt64() {
+		err = fmt.Errorf("Python timedelta %s is out of range", stringify(pyDelta))
+		return
+	}
+
+	d = time.Duration(total.Int64())
+	return
+}
@@ -4,6 +4,11 @@ import (
 	"github.com/tsavola/go-python"
 )
 
+type X struct {
+	A int
+	B float64 `py:"b"`
+}
+
 func main() {
 	module, err := python.Import(nil, "collections")
 	if err != nil {
@@ -29,4 +34,13 @@ func main() {
 
 	println(array[0].(int))
 	println(array[1].(float64))
+
+	var x X
+
+	if err := opaque.Unmarshal(nil, &x); err != nil {
+		panic(err)
+	}
+
+	println(x.A)
+	println(x.B)
 }
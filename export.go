@@ -0,0 +1,136 @@
+package python
+
+// Functions called by C code.  The preamble may contain only declarations.
+// Python objects are passed as void pointers, as including Python.h here would
+// conflict with the headers of the generated C code.
+
+/*
+
+#include <stdint.h>
+#include <sys/types.h>
+
+*/
+import "C"
+
+import (
+	"runtime/cgo"
+	"unsafe"
+)
+
+//export goReleaseBuffer
+func goReleaseBuffer(handle C.uintptr_t) {
+	releaseBuffer(cgo.Handle(handle))
+}
+
+//export goRelease
+func goRelease(handle C.uintptr_t) {
+	releaseHandle(cgo.Handle(handle))
+}
+
+//export goRepr
+func goRepr(handle C.uintptr_t) unsafe.Pointer {
+	return unsafe.Pointer(handleRepr(cgo.Handle(handle)))
+}
+
+//export goProxyGetAttr
+func goProxyGetAttr(handle C.uintptr_t, pyName unsafe.Pointer) (pyResult unsafe.Pointer) {
+	if !catch(func() (err error) {
+		name, err := attrName(pyObject(pyName))
+		if err == nil {
+			pyResult, err = pointer(cgo.Handle(handle).Value().(*proxy).getAttr(name))
+		}
+		return
+	}) {
+		pyResult = nil
+	}
+	return
+}
+
+//export goProxySetAttr
+func goProxySetAttr(handle C.uintptr_t, pyName, pyValue unsafe.Pointer) C.int {
+	if !catch(func() (err error) {
+		name, err := attrName(pyObject(pyName))
+		if err == nil {
+			err = cgo.Handle(handle).Value().(*proxy).setAttr(name, pyObject(pyValue))
+		}
+		return
+	}) {
+		return -1
+	}
+	return 0
+}
+
+//export goProxyLength
+func goProxyLength(handle C.uintptr_t) (length C.ssize_t) {
+	if !catch(func() error {
+		n, err := cgo.Handle(handle).Value().(*proxy).length()
+		length = C.ssize_t(n)
+		return err
+	}) {
+		length = -1
+	}
+	return
+}
+
+//export goProxyGetItem
+func goProxyGetItem(handle C.uintptr_t, pyKey unsafe.Pointer) (pyResult unsafe.Pointer) {
+	if !catch(func() (err error) {
+		pyResult, err = pointer(cgo.Handle(handle).Value().(*proxy).getItem(pyObject(pyKey)))
+		return
+	}) {
+		pyResult = nil
+	}
+	return
+}
+
+//export goProxySetItem
+func goProxySetItem(handle C.uintptr_t, pyKey, pyValue unsafe.Pointer) C.int {
+	if !catch(func() error {
+		return cgo.Handle(handle).Value().(*proxy).setItem(pyObject(pyKey), pyObject(pyValue))
+	}) {
+		return -1
+	}
+	return 0
+}
+
+//export goProxyIter
+func goProxyIter(handle C.uintptr_t) (pyResult unsafe.Pointer) {
+	if !catch(func() (err error) {
+		pyResult, err = pointer(cgo.Handle(handle).Value().(*proxy).iter())
+		return
+	}) {
+		pyResult = nil
+	}
+	return
+}
+
+//export goFunctionCall
+func goFunctionCall(handle C.uintptr_t, pyArgs, pyKwargs unsafe.Pointer) (pyResult unsafe.Pointer) {
+	if !catch(func() (err error) {
+		pyResult, err = pointer(cgo.Handle(handle).Value().(callable).call(pyObject(pyArgs), pyObject(pyKwargs)))
+		return
+	}) {
+		pyResult = nil
+	}
+	return
+}
+
+//export goNewInstance
+func goNewInstance(pyClass unsafe.Pointer) (handle C.uintptr_t) {
+	catch(func() error {
+		h, err := allocInstance(pyObject(pyClass))
+		handle = C.uintptr_t(h)
+		return err
+	})
+	return
+}
+
+//export goProfileEnter
+func goProfileEnter(handle C.uintptr_t, key, typ, pyFunction unsafe.Pointer) {
+	cgo.Handle(handle).Value().(*threadProfile).enter(key, typ, pyObject(pyFunction))
+}
+
+//export goProfileLeave
+func goProfileLeave(handle C.uintptr_t) {
+	cgo.Handle(handle).Value().(*threadProfile).leave()
+}
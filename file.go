@@ -0,0 +1,433 @@
+package python
+
+/*
+
+#include <Python.h>
+
+*/
+import "C"
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// file is the implementation of the go.File class, which is the Python
+// representation of Go readers and writers.
+type file struct {
+	lock sync.Mutex
+	r    io.Reader
+	w    io.Writer
+	s    io.Seeker
+	c    io.Closer
+
+	Closed    bool
+	Softspace int // used by the print statement
+}
+
+var fileClass = internalClass{
+	name: "File",
+	typ:  reflect.TypeOf(file{}),
+
+	// Avoid conflict with standard Go method signature.
+	methodNames: map[string]string{
+		"SeekPosition": "seek",
+	},
+
+	readOnly: map[string]bool{
+		"Closed": true,
+	},
+}
+
+// FileObject is translated to a Python file-like object.  See File.
+type FileObject struct {
+	Value interface{}
+}
+
+// File wraps a Go value which implements io.Reader, io.Writer, io.Seeker
+// and/or io.Closer so that it is translated to a Python file-like object.
+// Its methods support reading, writing, seeking and closing accordingly.
+// Reading returns str objects.  Writing accepts str objects and other objects
+// which support the buffer protocol, but not unicode objects.
+//
+// The reader is not buffered: no more data is read than Python code asks
+// for, so that the remaining data can still be read by Go code.
+func File(v interface{}) FileObject {
+	return FileObject{v}
+}
+
+// encodeFile translates a value wrapped by File.
+func encodeFile(x interface{}) (pyFile *C.PyObject, err error) {
+	f := new(file)
+	f.r, _ = x.(io.Reader)
+	f.w, _ = x.(io.Writer)
+	f.s, _ = x.(io.Seeker)
+	f.c, _ = x.(io.Closer)
+
+	if f.r == nil && f.w == nil && f.s == nil && f.c == nil {
+		err = fmt.Errorf("unable to translate %T to a Python file object", x)
+		return
+	}
+
+	if err = fileClass.define(); err != nil {
+		return
+	}
+
+	pyFile, _, err = newInstance(reflect.ValueOf(f))
+	return
+}
+
+// appendBytes copies the contents of a str object or another object which
+// supports the buffer protocol.
+func appendBytes(data []byte, pyValue *C.PyObject) (_ []byte, err error) {
+	switch typeOf(pyValue) {
+	case 4:
+		var (
+			cString *C.char
+			size    C.Py_ssize_t
+		)
+
+		if C.PyString_AsStringAndSize(pyValue, &cString, &size) < 0 {
+			err = getError()
+			return
+		}
+
+		return append(data, unsafe.Slice((*byte)(unsafe.Pointer(cString)), size)...), nil
+
+	case 11:
+		err = typeError("unicode objects must be encoded before writing")
+		return
+	}
+
+	b, err := getBuffer(pyValue)
+	if err != nil {
+		C.PyErr_Clear()
+		err = typeError("expected a string or other character buffer object")
+		return
+	}
+
+	data = append(data, b.Bytes()...)
+	b.release()
+	return data, nil
+}
+
+func (f *file) check() error {
+	if f.Closed {
+		return valueError("I/O operation on closed file")
+	}
+	return nil
+}
+
+func (f *file) reader() (r io.Reader, err error) {
+	if err = f.check(); err == nil && f.r == nil {
+		err = ioError("File not open for reading")
+	}
+	r = f.r
+	return
+}
+
+func (f *file) writer() (w io.Writer, err error) {
+	if err = f.check(); err == nil && f.w == nil {
+		err = ioError("File not open for writing")
+	}
+	w = f.w
+	return
+}
+
+// readByte reads one byte at a time unless the reader implements
+// io.ByteReader.
+func readByte(r io.Reader) (c byte, err error) {
+	if br, ok := r.(io.ByteReader); ok {
+		return br.ReadByte()
+	}
+
+	var b [1]byte
+
+	for {
+		var n int
+
+		if n, err = r.Read(b[:]); n > 0 {
+			return b[0], nil
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (f *file) seeker() (s io.Seeker, err error) {
+	if err = f.check(); err == nil && f.s == nil {
+		err = ioError("File is not seekable")
+	}
+	s = f.s
+	return
+}
+
+func optionalInt(name string, args []int, value int) (int, error) {
+	switch len(args) {
+	case 0:
+		return value, nil
+
+	case 1:
+		return args[0], nil
+
+	default:
+		return 0, typeError("%s takes at most 1 argument (%d given)", name, len(args))
+	}
+}
+
+func (f *file) Read(size ...int) (data Bytes, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	n, err := optionalInt("read", size, -1)
+	if err != nil {
+		return
+	}
+
+	r, err := f.reader()
+	if err != nil {
+		return
+	}
+
+	var b []byte
+
+	if n < 0 {
+		b, err = io.ReadAll(r)
+	} else {
+		b = make([]byte, n)
+		n, err = io.ReadFull(r, b)
+		b = b[:n]
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		err = ioError("%v", err)
+		return
+	}
+
+	data = Bytes(b)
+	return
+}
+
+func (f *file) Readline(size ...int) (line Bytes, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	n, err := optionalInt("readline", size, -1)
+	if err != nil {
+		return
+	}
+
+	return f.readline(n)
+}
+
+func (f *file) readline(n int) (line Bytes, err error) {
+	r, err := f.reader()
+	if err != nil {
+		return
+	}
+
+	var b []byte
+
+	for n < 0 || len(b) < n {
+		var c byte
+
+		if c, err = readByte(r); err != nil {
+			break
+		}
+
+		b = append(b, c)
+		if c == '\n' {
+			break
+		}
+	}
+
+	if err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		err = ioError("%v", err)
+		return
+	}
+
+	line = Bytes(b)
+	return
+}
+
+func (f *file) Readlines(hint ...int) (lines List, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	limit, err := optionalInt("readlines", hint, 0)
+	if err != nil {
+		return
+	}
+
+	lines = List{}
+	total := 0
+
+	for limit <= 0 || total < limit {
+		var line Bytes
+
+		if line, err = f.readline(-1); err != nil || len(line) == 0 {
+			return
+		}
+
+		lines = append(lines, line)
+		total += len(line)
+	}
+	return
+}
+
+func (f *file) Write(t *Thread, data Object) (err error) {
+	if data == nil {
+		return typeError("expected a string or other character buffer object")
+	}
+
+	var b []byte
+
+	t.execute(func() {
+		b, err = appendBytes(nil, data.(*object).pyObject)
+	})
+	if err != nil {
+		return
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	w, err := f.writer()
+	if err != nil {
+		return
+	}
+
+	if _, err = w.Write(b); err != nil {
+		err = ioError("%v", err)
+	}
+	return
+}
+
+func (f *file) Writelines(t *Thread, lines []Object) (err error) {
+	for _, line := range lines {
+		if err = f.Write(t, line); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (f *file) Flush() (err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err = f.check(); err != nil {
+		return
+	}
+
+	if flusher, ok := f.w.(interface {
+		Flush() error
+	}); ok {
+		if err = flusher.Flush(); err != nil {
+			err = ioError("%v", err)
+		}
+	}
+	return
+}
+
+func (f *file) SeekPosition(offset int64, whence ...int) (err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	w, err := optionalInt("seek", whence, io.SeekStart)
+	if err != nil {
+		return
+	}
+
+	s, err := f.seeker()
+	if err != nil {
+		return
+	}
+
+	if _, err = s.Seek(offset, w); err != nil {
+		err = ioError("%v", err)
+	}
+	return
+}
+
+func (f *file) Tell() (pos int64, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	s, err := f.seeker()
+	if err != nil {
+		return
+	}
+
+	if pos, err = s.Seek(0, io.SeekCurrent); err != nil {
+		err = ioError("%v", err)
+	}
+	return
+}
+
+func (f *file) Close() (err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.Closed {
+		return
+	}
+
+	f.Closed = true
+
+	if f.c != nil {
+		if err = f.c.Close(); err != nil {
+			err = ioError("%v", err)
+		}
+	}
+	return
+}
+
+func (f *file) Isatty() (bool, error) {
+	return false, f.check()
+}
+
+func (f *file) Readable() bool {
+	return f.r != nil
+}
+
+func (f *file) Writable() bool {
+	return f.w != nil
+}
+
+func (f *file) Seekable() bool {
+	return f.s != nil
+}
+
+func (f *file) PyIter() (*file, error) {
+	return f, f.check()
+}
+
+func (f *file) Next() (line Bytes, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if line, err = f.readline(-1); err == nil && len(line) == 0 {
+		err = stopIteration
+	}
+	return
+}
+
+func (f *file) PyEnter() (*file, error) {
+	return f, f.check()
+}
+
+func (f *file) PyExit(args ...Object) (bool, error) {
+	return false, f.Close()
+}
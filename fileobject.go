@@ -0,0 +1,266 @@
+package python
+
+/*
+
+#include <Python.h>
+
+*/
+import "C"
+
+import (
+	"errors"
+	"io"
+)
+
+// fileChunkSize is the minimum amount of data transferred per Python call.
+const fileChunkSize = 64 * 1024
+
+var errNoFile = errors.New("Python file object is None")
+
+// Reader reads from a Python file-like object via its read method.  Data is
+// requested in large chunks and buffered.  str objects and other objects which
+// support the buffer protocol are read as is; unicode objects are encoded as
+// UTF-8.  Reader is not safe for concurrent use.
+type Reader struct {
+	t   *Thread
+	o   Object
+	buf []byte
+	off int
+	eof bool
+}
+
+// NewReader creates a reader which calls Python using the given Thread.
+func NewReader(t *Thread, o Object) *Reader {
+	return &Reader{t: t, o: o}
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return
+	}
+
+	if r.off == len(r.buf) {
+		if r.eof {
+			err = io.EOF
+			return
+		}
+
+		size := fileChunkSize
+		if len(p) > size {
+			size = len(p)
+		}
+
+		r.off = 0
+		if r.buf, err = readChunk(r.t, r.o, r.buf[:0], size); err != nil {
+			return
+		}
+
+		if len(r.buf) == 0 {
+			r.eof = true
+			err = io.EOF
+			return
+		}
+	}
+
+	n = copy(p, r.buf[r.off:])
+	r.off += n
+	return
+}
+
+// Close calls the close method of the Python object.  Buffered data is
+// discarded.
+func (r *Reader) Close() (err error) {
+	r.buf = nil
+	r.off = 0
+	r.eof = true
+
+	return closeFile(r.t, r.o)
+}
+
+// readChunk calls the read method of a Python object and appends the result to
+// a buffer.
+func readChunk(t *Thread, o Object, buf []byte, size int) (_ []byte, err error) {
+	if o == nil {
+		err = errNoFile
+		return
+	}
+
+	t.execute(func() {
+		var (
+			pyType C.int
+			pyData *C.PyObject
+		)
+
+		if pyType, pyData, err = call(o.(*object).pyObject, "read", []interface{}{size}); err != nil {
+			return
+		}
+		defer xDECREF(pyData)
+
+		switch pyType {
+		case 1:
+			// Treated like end of file.
+
+		case 11:
+			var s string
+			if s, err = decodeUnicode(pyData); err == nil {
+				buf = append(buf, s...)
+			}
+
+		case 2, 3:
+			err = typeError("read() returned a bool")
+
+		default:
+			buf, err = appendBytes(buf, pyData)
+		}
+	})
+
+	return buf, err
+}
+
+// Writer writes to a Python file-like object via its write method.  Data is
+// buffered and written in large chunks as str objects.  Flush or Close must be
+// called after the last write.  Writer is not safe for concurrent use.
+type Writer struct {
+	t   *Thread
+	o   Object
+	buf []byte
+}
+
+// NewWriter creates a writer which calls Python using the given Thread.
+func NewWriter(t *Thread, o Object) *Writer {
+	return &Writer{t: t, o: o}
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if len(w.buf)+len(p) > fileChunkSize {
+		if err = w.writeBuffered(); err != nil {
+			return
+		}
+
+		if len(p) >= fileChunkSize {
+			if err = writeChunk(w.t, w.o, p); err == nil {
+				n = len(p)
+			}
+			return
+		}
+	}
+
+	w.buf = append(w.buf, p...)
+	n = len(p)
+	return
+}
+
+// Flush writes buffered data and calls the flush method of the Python object
+// (if it has one).
+func (w *Writer) Flush() (err error) {
+	if err = w.writeBuffered(); err != nil {
+		return
+	}
+
+	if w.o == nil {
+		return errNoFile
+	}
+
+	w.t.execute(func() {
+		pyFile := w.o.(*object).pyObject
+
+		if C.PyObject_HasAttrString(pyFile, cFlush) != 0 {
+			var pyResult *C.PyObject
+
+			_, pyResult, err = call(pyFile, "flush", nil)
+			xDECREF(pyResult)
+		}
+	})
+	return
+}
+
+var cFlush = C.CString("flush")
+
+// Close writes buffered data and calls the close method of the Python object.
+func (w *Writer) Close() (err error) {
+	err = w.writeBuffered()
+
+	if e := closeFile(w.t, w.o); err == nil {
+		err = e
+	}
+	return
+}
+
+func (w *Writer) writeBuffered() (err error) {
+	if len(w.buf) > 0 {
+		if err = writeChunk(w.t, w.o, w.buf); err == nil {
+			w.buf = w.buf[:0]
+		}
+	}
+	return
+}
+
+// writeChunk calls the write method of a Python object until all data has been
+// written.  The method may return None or the number of bytes written.
+func writeChunk(t *Thread, o Object, data []byte) (err error) {
+	if o == nil {
+		return errNoFile
+	}
+
+	t.execute(func() {
+		pyFile := o.(*object).pyObject
+
+		for len(data) > 0 {
+			var (
+				pyType   C.int
+				pyResult *C.PyObject
+				result   interface{}
+			)
+
+			if pyType, pyResult, err = call(pyFile, "write", []interface{}{Bytes(data)}); err != nil {
+				return
+			}
+
+			if pyType == 1 {
+				return
+			}
+
+			result, err = decodeType(pyType, pyResult)
+			xDECREF(pyResult)
+			if err != nil {
+				return
+			}
+
+			var n int
+
+			switch x := result.(type) {
+			case int:
+				n = x
+
+			case int64:
+				n = int(x)
+
+			default:
+				n = -1
+			}
+
+			if n < 0 || n > len(data) {
+				err = typeError("write() returned %v", result)
+				return
+			}
+			if n == 0 {
+				err = io.ErrShortWrite
+				return
+			}
+
+			data = data[n:]
+		}
+	})
+	return
+}
+
+func closeFile(t *Thread, o Object) (err error) {
+	if o == nil {
+		return errNoFile
+	}
+
+	_, err = o.Call(t, "close")
+	return
+}
@@ -1 +1,3 @@
 module github.com/tsavola/go-python
+
+go 1.21
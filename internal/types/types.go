@@ -0,0 +1,36 @@
+// Package types declares the Go value model shared by the python package and
+// its cgo-free subpackages.  The python package re-exports the types as
+// aliases; see it for documentation.
+package types
+
+import (
+	"time"
+)
+
+type Bytes string
+
+type Unicode string
+
+type List []interface{}
+
+type Tuple []interface{}
+
+type Set map[interface{}]struct{}
+
+type FrozenSet map[interface{}]struct{}
+
+type ByteArray []byte
+
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+type TimeOfDay struct {
+	Hour        int
+	Minute      int
+	Second      int
+	Microsecond int
+	Location    *time.Location
+}
@@ -0,0 +1,483 @@
+package python
+
+/*
+
+#include <Python.h>
+
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONValue converts a value translated from Python to a value which can be
+// marshaled by the encoding/json package.  Maps get string keys (converted
+// like Python's json module does), sequences and sets become []interface{},
+// and integers which don't fit in 64 bits become json.Number.  str, unicode
+// and bytearray values become strings.  Date and TimeOfDay are formatted in
+// ISO 8601 format and time.Duration is converted to seconds.  Complex
+// numbers, infinities and NaNs cannot be represented.  Other Go values are
+// left for encoding/json to handle.
+func JSONValue(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case nil, bool, string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr, time.Time:
+		return x, nil
+
+	case float32:
+		return jsonFloat(float64(x))
+
+	case float64:
+		return jsonFloat(x)
+
+	case complex64, complex128:
+		return nil, fmt.Errorf("unable to represent complex number %v in JSON", x)
+
+	case *big.Int:
+		if x == nil {
+			return nil, nil
+		}
+		return json.Number(x.String()), nil
+
+	case Bytes:
+		return string(x), nil
+
+	case Unicode:
+		return string(x), nil
+
+	case []byte:
+		return string(x), nil
+
+	case ByteArray:
+		return string(x), nil
+
+	case []interface{}:
+		return jsonArray(x)
+
+	case List:
+		return jsonArray(x)
+
+	case Tuple:
+		return jsonArray(x)
+
+	case Set:
+		return jsonSet(x)
+
+	case FrozenSet:
+		return jsonSet(x)
+
+	case map[interface{}]interface{}:
+		return jsonObject(x)
+
+	case Date:
+		return fmt.Sprintf("%04d-%02d-%02d", x.Year, x.Month, x.Day), nil
+
+	case TimeOfDay:
+		return jsonTimeOfDay(x), nil
+
+	case time.Duration:
+		return x.Seconds(), nil
+
+	case Decimal:
+		if _, ok := x.Rat(); !ok {
+			return nil, fmt.Errorf("unable to represent decimal %s in JSON", x)
+		}
+		return json.Number(x), nil
+
+	case UUID:
+		return x.String(), nil
+
+	default:
+		return x, nil
+	}
+}
+
+func jsonFloat(f float64) (interface{}, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("unable to represent %v in JSON", f)
+	}
+	return f, nil
+}
+
+func jsonArray(array []interface{}) (result []interface{}, err error) {
+	result = make([]interface{}, len(array))
+
+	for i, item := range array {
+		if result[i], err = JSONValue(item); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func jsonSet(set map[interface{}]struct{}) (result []interface{}, err error) {
+	result = make([]interface{}, 0, len(set))
+
+	for item := range set {
+		var value interface{}
+
+		if value, err = JSONValue(item); err != nil {
+			return
+		}
+
+		result = append(result, value)
+	}
+	return
+}
+
+func jsonObject(m map[interface{}]interface{}) (result map[string]interface{}, err error) {
+	result = make(map[string]interface{}, len(m))
+
+	for key, item := range m {
+		var (
+			name  string
+			value interface{}
+		)
+
+		if name, err = jsonKey(key); err != nil {
+			return
+		}
+
+		if _, dup := result[name]; dup {
+			err = fmt.Errorf("duplicate JSON object key %q", name)
+			return
+		}
+
+		if value, err = JSONValue(item); err != nil {
+			return
+		}
+
+		result[name] = value
+	}
+	return
+}
+
+// jsonKey converts a dict key to a string like Python's json module does.
+func jsonKey(key interface{}) (s string, err error) {
+	switch x := key.(type) {
+	case nil:
+		s = "null"
+
+	case bool:
+		s = strconv.FormatBool(x)
+
+	case string:
+		s = x
+
+	case Bytes:
+		s = string(x)
+
+	case Unicode:
+		s = string(x)
+
+	case int:
+		s = strconv.Itoa(x)
+
+	case int64:
+		s = strconv.FormatInt(x, 10)
+
+	case uint64:
+		s = strconv.FormatUint(x, 10)
+
+	case *big.Int:
+		s = x.String()
+
+	case float64:
+		switch {
+		case math.IsInf(x, 1):
+			s = "Infinity"
+
+		case math.IsInf(x, -1):
+			s = "-Infinity"
+
+		case math.IsNaN(x):
+			s = "NaN"
+
+		default:
+			s = jsonFloatKey(x)
+		}
+
+	default:
+		err = fmt.Errorf("unable to use %T as a JSON object key", key)
+	}
+	return
+}
+
+// jsonFloatKey formats a finite number like repr() does: the shortest
+// representation, in exponent notation if the exponent is less than -4 or at
+// least 16.
+func jsonFloatKey(f float64) string {
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+
+	if exp, _ := strconv.Atoi(s[strings.IndexByte(s, 'e')+1:]); exp >= -4 && exp < 16 {
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+	}
+	return s
+}
+
+// jsonTimeOfDay formats like datetime.time.isoformat().
+func jsonTimeOfDay(t TimeOfDay) string {
+	s := fmt.Sprintf("%02d:%02d:%02d", t.Hour, t.Minute, t.Second)
+	if t.Microsecond != 0 {
+		s += fmt.Sprintf(".%06d", t.Microsecond)
+	}
+
+	if t.Location != nil {
+		_, offset := time.Now().In(t.Location).Zone()
+
+		sign := '+'
+		if offset < 0 {
+			sign = '-'
+			offset = -offset
+		}
+
+		s += fmt.Sprintf("%c%02d:%02d", sign, offset/3600, offset/60%60)
+	}
+	return s
+}
+
+func (o *object) ValueJSON(t *Thread) (v interface{}, err error) {
+	t.execute(func() {
+		if v, err = decode(o.pyObject); err == nil {
+			v, err = JSONValue(v)
+		}
+	})
+	return
+}
+
+func (o *object) MarshalJSON() (data []byte, err error) {
+	defaultThread.execute(func() {
+		data, err = appendJSON(nil, o.pyObject, make(map[*C.PyObject]struct{}))
+	})
+	return
+}
+
+// appendJSON serializes a Python object.  Containers are traversed directly;
+// other objects are translated to Go values and marshaled.  The active set is
+// used to detect circular references.
+func appendJSON(data []byte, pyValue *C.PyObject, active map[*C.PyObject]struct{}) (_ []byte, err error) {
+	pyType := typeOf(pyValue)
+
+	switch pyType {
+	case 9, 10, 13, 14, 15, 16:
+		if v, ok := decodeProxy(pyValue); ok {
+			return appendJSONValue(data, v.Interface())
+		}
+
+		if value, ok, err := decodeRegistered(pyValue); ok {
+			if err != nil {
+				return data, err
+			}
+			return appendJSONValue(data, value)
+		}
+
+		if _, found := active[pyValue]; found {
+			err = fmt.Errorf("circular reference detected in %s", stringify(pyValue))
+			return
+		}
+
+		active[pyValue] = struct{}{}
+		defer delete(active, pyValue)
+
+	default:
+		var value interface{}
+
+		if value, err = decodeType(pyType, pyValue); err != nil {
+			return
+		}
+
+		return appendJSONValue(data, value)
+	}
+
+	switch pyType {
+	case 10:
+		return appendJSONObject(data, pyValue, active)
+
+	case 13, 14:
+		return appendJSONIterable(data, pyValue, active)
+
+	default:
+		return appendJSONSequence(data, pyValue, active)
+	}
+}
+
+func appendJSONValue(data []byte, value interface{}) (_ []byte, err error) {
+	if value, err = JSONValue(value); err != nil {
+		return data, err
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return data, err
+	}
+
+	return append(data, b...), nil
+}
+
+func appendJSONSequence(data []byte, pySequence *C.PyObject, active map[*C.PyObject]struct{}) (_ []byte, err error) {
+	length := int(C.PySequence_Size(pySequence))
+	if length < 0 {
+		return data, getError()
+	}
+
+	data = append(data, '[')
+
+	for i := 0; i < length; i++ {
+		if i > 0 {
+			data = append(data, ',')
+		}
+
+		pyItem := C.PySequence_GetItem(pySequence, C.Py_ssize_t(i))
+		if pyItem == nil {
+			return data, getError()
+		}
+
+		data, err = appendJSON(data, pyItem, active)
+		C.Py_DecRef(pyItem)
+		if err != nil {
+			return
+		}
+	}
+
+	return append(data, ']'), nil
+}
+
+func appendJSONIterable(data []byte, pyIterable *C.PyObject, active map[*C.PyObject]struct{}) (_ []byte, err error) {
+	pyIter := C.PyObject_GetIter(pyIterable)
+	if pyIter == nil {
+		return data, getError()
+	}
+	defer C.Py_DecRef(pyIter)
+
+	data = append(data, '[')
+
+	for i := 0; ; i++ {
+		pyItem := C.PyIter_Next(pyIter)
+		if pyItem == nil {
+			if C.PyErr_Occurred() != nil {
+				return data, getError()
+			}
+			break
+		}
+
+		if i > 0 {
+			data = append(data, ',')
+		}
+
+		data, err = appendJSON(data, pyItem, active)
+		C.Py_DecRef(pyItem)
+		if err != nil {
+			return
+		}
+	}
+
+	return append(data, ']'), nil
+}
+
+type jsonMember struct {
+	name    string
+	pyValue *C.PyObject
+}
+
+// newJSONMember converts a (key, value) pair.  The member holds a reference
+// to the value.
+func newJSONMember(pyPair *C.PyObject) (m jsonMember, err error) {
+	pyKey, pyValue, err := unpackPair(pyPair)
+	if err != nil {
+		return
+	}
+
+	key, err := decode(pyKey)
+	if err != nil {
+		return
+	}
+
+	if m.name, err = jsonKey(key); err != nil {
+		return
+	}
+
+	C.Py_IncRef(pyValue)
+	m.pyValue = pyValue
+	return
+}
+
+// appendJSONObject serializes a mapping with its keys sorted, like
+// encoding/json does with maps.
+func appendJSONObject(data []byte, pyMapping *C.PyObject, active map[*C.PyObject]struct{}) (_ []byte, err error) {
+	pyItems := mappingItems(pyMapping)
+	if pyItems == nil {
+		return data, getError()
+	}
+	defer C.Py_DecRef(pyItems)
+
+	length := int(C.PySequence_Size(pyItems))
+	if length < 0 {
+		return data, getError()
+	}
+
+	members := make([]jsonMember, 0, length)
+	defer func() {
+		for _, m := range members {
+			C.Py_DecRef(m.pyValue)
+		}
+	}()
+
+	for i := 0; i < length; i++ {
+		pyPair := C.PySequence_GetItem(pyItems, C.Py_ssize_t(i))
+		if pyPair == nil {
+			return data, getError()
+		}
+
+		var m jsonMember
+
+		m, err = newJSONMember(pyPair)
+		C.Py_DecRef(pyPair)
+		if err != nil {
+			return
+		}
+
+		members = append(members, m)
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].name < members[j].name
+	})
+
+	data = append(data, '{')
+
+	for i, m := range members {
+		if i > 0 {
+			if m.name == members[i-1].name {
+				err = fmt.Errorf("duplicate JSON object key %q", m.name)
+				return
+			}
+
+			data = append(data, ',')
+		}
+
+		var name []byte
+
+		if name, err = json.Marshal(m.name); err != nil {
+			return
+		}
+
+		data = append(data, name...)
+		data = append(data, ':')
+
+		if data, err = appendJSON(data, m.pyValue, active); err != nil {
+			return
+		}
+	}
+
+	return append(data, '}'), nil
+}
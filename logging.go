@@ -0,0 +1,151 @@
+package python
+
+/*
+
+#include <Python.h>
+
+*/
+import "C"
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+const logHandlerSource = `
+import logging
+
+_standard = frozenset(logging.LogRecord("", 0, "", 0, "", (), None).__dict__) | frozenset(["message", "asctime"])
+
+class LogHandler(logging.Handler):
+	def __init__(self, emit, level=logging.NOTSET):
+		logging.Handler.__init__(self, level)
+		self._emit = emit
+
+	def emit(self, record):
+		try:
+			exc_text = record.exc_text
+			if record.exc_info and not exc_text:
+				exc_text = (self.formatter or logging._defaultFormatter).formatException(record.exc_info)
+
+			self._emit({
+				"levelno":  record.levelno,
+				"name":     record.name,
+				"message":  record.getMessage(),
+				"created":  record.created,
+				"exc_text": exc_text,
+				"pathname": record.pathname,
+				"lineno":   record.lineno,
+				"funcName": record.funcName,
+				"extra":    dict((k, v) for k, v in record.__dict__.iteritems() if k not in _standard),
+			})
+		except (KeyboardInterrupt, SystemExit):
+			raise
+		except:
+			self.handleError(record)
+`
+
+var logHandlerClass = lazyClass{source: logHandlerSource, name: "LogHandler"}
+
+// NewLogHandler creates an instance of a logging.Handler subclass which
+// forwards records emitted by Python's logging module to a Go logger.  It can
+// be added to Python loggers with their addHandler method.
+//
+// Record levels are converted with LogLevel.  The message is formatted by the
+// record's getMessage method; the logger name, source location, formatted
+// exception and attributes passed via the extra parameter are added as
+// attributes.  Extra values which cannot be translated to Go values are
+// formatted with str().
+func NewLogHandler(t *Thread, logger *slog.Logger) (handler Object, err error) {
+	emit := func(thread *Thread, r logRecord) error {
+		return r.emit(thread, logger)
+	}
+
+	t.execute(func() {
+		var pyClass, pyHandler *C.PyObject
+
+		if pyClass, err = logHandlerClass.get(); err != nil {
+			return
+		}
+
+		if _, pyHandler, err = invoke(pyClass, []interface{}{Proxy(emit)}); err != nil {
+			return
+		}
+		defer C.Py_DecRef(pyHandler)
+
+		handler = newObject(pyHandler)
+	})
+	return
+}
+
+// LogLevel converts a level of Python's logging module to a Go log level.
+// DEBUG, INFO, WARNING, ERROR and CRITICAL correspond to slog.LevelDebug,
+// LevelInfo, LevelWarn, LevelError and LevelError+4; levels between them are
+// scaled linearly.
+func LogLevel(level int) slog.Level {
+	return slog.Level((level - 20) * 2 / 5)
+}
+
+// logRecord holds the parts of a Python LogRecord which are forwarded.
+type logRecord struct {
+	Level    int `py:"levelno"`
+	Name     string
+	Message  string
+	Created  float64
+	ExcText  *string
+	Pathname string
+	Lineno   int
+	FuncName string
+	Extra    map[string]Object
+}
+
+func (r *logRecord) emit(t *Thread, logger *slog.Logger) error {
+	ctx := context.Background()
+	level := LogLevel(r.Level)
+
+	if !logger.Enabled(ctx, level) {
+		return nil
+	}
+
+	sec := int64(r.Created)
+	when := time.Unix(sec, int64((r.Created-float64(sec))*1e9))
+
+	record := slog.NewRecord(when, level, r.Message, 0)
+	record.AddAttrs(slog.String("logger", r.Name))
+
+	if r.Pathname != "" {
+		record.AddAttrs(slog.Any(slog.SourceKey, &slog.Source{
+			Function: r.FuncName,
+			File:     r.Pathname,
+			Line:     r.Lineno,
+		}))
+	}
+
+	if r.ExcText != nil {
+		record.AddAttrs(slog.String("exception", *r.ExcText))
+	}
+
+	keys := make([]string, 0, len(r.Extra))
+	for key := range r.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var value interface{}
+
+		if o := r.Extra[key]; o != nil {
+			var err error
+
+			if value, err = o.Value(t); err != nil {
+				value = o.String()
+			}
+		}
+
+		record.AddAttrs(slog.Any(key, value))
+	}
+
+	return logger.Handler().Handle(ctx, record)
+}
@@ -0,0 +1,108 @@
+package python
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ThreadMetrics is a snapshot of the activity of a Thread.  The values are
+// cumulative since the Thread was created, except Objects.  They are read
+// individually, so a snapshot taken while the Thread is busy may be slightly
+// inconsistent.  Errors and Objects which originate from Python threads not
+// created by this package are not counted.
+//
+// The values map directly to Prometheus counters, gauges and histograms
+// (e.g. via prometheus.MustNewConstHistogram), and a snapshot function can be
+// published with expvar.Func.
+type ThreadMetrics struct {
+	Calls     uint64    // operations executed by the Thread
+	Errors    uint64    // Python exceptions converted to Go errors
+	Objects   int64     // Objects created by the Thread which are still alive
+	QueueWait Histogram // time between submitting an operation and its start
+	Execution Histogram // time spent executing an operation, including Go callbacks
+}
+
+// Histogram of durations.
+type Histogram struct {
+	Count   uint64
+	Sum     time.Duration
+	Buckets []HistogramBucket // in ascending order; +Inf is implicit (Count)
+}
+
+// HistogramBucket counts the observations which were less than or equal to
+// the upper bound (including the ones counted by the preceding buckets).
+type HistogramBucket struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+var durationBuckets = [...]time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+type histogram struct {
+	counts [len(durationBuckets) + 1]atomic.Uint64
+	sum    atomic.Int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := sort.Search(len(durationBuckets), func(i int) bool {
+		return d <= durationBuckets[i]
+	})
+
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *histogram) snapshot() (s Histogram) {
+	s.Buckets = make([]HistogramBucket, len(durationBuckets))
+
+	for i, bound := range durationBuckets {
+		s.Count += h.counts[i].Load()
+		s.Buckets[i] = HistogramBucket{bound, s.Count}
+	}
+
+	s.Count += h.counts[len(durationBuckets)].Load()
+	s.Sum = time.Duration(h.sum.Load())
+	return
+}
+
+type threadMetrics struct {
+	calls     atomic.Uint64
+	errors    atomic.Uint64
+	objects   atomic.Int64
+	queueWait histogram
+	execution histogram
+}
+
+// executed is called on the Thread after an operation.
+func (m *threadMetrics) executed(queued, start time.Time) {
+	m.calls.Add(1)
+	m.queueWait.observe(start.Sub(queued))
+	m.execution.observe(time.Since(start))
+}
+
+// Metrics gets a snapshot of the Thread's activity.
+func (t *Thread) Metrics() ThreadMetrics {
+	if t == nil {
+		t = defaultThread
+	}
+
+	m := &t.metrics
+
+	return ThreadMetrics{
+		Calls:     m.calls.Load(),
+		Errors:    m.errors.Load(),
+		Objects:   m.objects.Load(),
+		QueueWait: m.queueWait.snapshot(),
+		Execution: m.execution.snapshot(),
+	}
+}
@@ -0,0 +1,1158 @@
+package pickle
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	errStackUnderflow = errors.New("pickle: stack underflow")
+	errMarkNotFound   = errors.New("pickle: mark not found")
+	errRecursive      = errors.New("pickle: recursive objects are not supported")
+	errInvalidArgs    = errors.New("invalid arguments")
+)
+
+// Decoder reads pickles from an input stream.  Like with Python's Unpickler,
+// the memo is shared by the consecutive pickles of a stream.
+type Decoder struct {
+	// TypedSequences makes tuples and lists be decoded as Tuple and List
+	// instead of []interface{}.
+	TypedSequences bool
+
+	r     *bufio.Reader
+	stack []interface{}
+	marks []int
+	memo  map[int64]interface{}
+}
+
+// Intermediate representations of objects which are being decoded.  Lists and
+// dicts are mutable and may be referenced via the memo before they are
+// complete, so they are converted to Go values only at the end.
+type (
+	tuple []interface{}
+
+	list struct {
+		items []interface{}
+	}
+
+	dict struct {
+		items []interface{} // keys and values interleaved
+	}
+
+	global struct {
+		module string
+		name   string
+		reduce reducer
+	}
+)
+
+// reducer reconstructs an object from the arguments of a REDUCE opcode.
+type reducer func(args []interface{}) (interface{}, error)
+
+// NewDecoder reads from a stream.  Data may be read ahead from it.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		r:    bufio.NewReader(r),
+		memo: make(map[int64]interface{}),
+	}
+}
+
+// Decode reads the next pickle.  io.EOF is returned if the stream ends before
+// the pickle begins.
+func (d *Decoder) Decode() (value interface{}, err error) {
+	d.stack = d.stack[:0]
+	d.marks = d.marks[:0]
+
+	for first := true; ; first = false {
+		var op byte
+
+		if op, err = d.r.ReadByte(); err != nil {
+			if err == io.EOF && !first {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+
+		if op == opStop {
+			var x interface{}
+
+			if x, err = d.pop(); err != nil {
+				return
+			}
+
+			return newConverter(d.TypedSequences).convert(x)
+		}
+
+		if err = d.execute(op); err != nil {
+			return
+		}
+	}
+}
+
+func (d *Decoder) execute(op byte) (err error) {
+	switch op {
+	case opMark:
+		d.marks = append(d.marks, len(d.stack))
+
+	case opPop:
+		if n := len(d.marks); n > 0 && d.marks[n-1] == len(d.stack) {
+			d.marks = d.marks[:n-1]
+		} else {
+			_, err = d.pop()
+		}
+
+	case opPopMark:
+		_, err = d.popMark()
+
+	case opDup:
+		var x interface{}
+		if x, err = d.top(); err == nil {
+			d.push(x)
+		}
+
+	case opNone:
+		d.push(nil)
+
+	case opNewTrue:
+		d.push(true)
+
+	case opNewFalse:
+		d.push(false)
+
+	case opInt:
+		err = d.loadInt()
+
+	case opBinInt:
+		var b []byte
+		if b, err = d.read(4); err == nil {
+			d.push(int(int32(binary.LittleEndian.Uint32(b))))
+		}
+
+	case opBinInt1:
+		var b []byte
+		if b, err = d.read(1); err == nil {
+			d.push(int(b[0]))
+		}
+
+	case opBinInt2:
+		var b []byte
+		if b, err = d.read(2); err == nil {
+			d.push(int(binary.LittleEndian.Uint16(b)))
+		}
+
+	case opLong:
+		err = d.loadLong()
+
+	case opLong1:
+		var b []byte
+		if b, err = d.read(1); err == nil {
+			err = d.loadBinLong(int(b[0]))
+		}
+
+	case opLong4:
+		var n int
+		if n, err = d.readSize(); err == nil {
+			err = d.loadBinLong(n)
+		}
+
+	case opFloat:
+		var s string
+		if s, err = d.readLine(); err != nil {
+			return
+		}
+
+		var f float64
+		if f, err = strconv.ParseFloat(s, 64); err != nil {
+			return fmt.Errorf("pickle: invalid float %q", s)
+		}
+		d.push(f)
+
+	case opBinFloat:
+		var b []byte
+		if b, err = d.read(8); err == nil {
+			d.push(math.Float64frombits(binary.BigEndian.Uint64(b)))
+		}
+
+	case opString:
+		err = d.loadString()
+
+	case opBinString:
+		var n int
+		if n, err = d.readSize(); err == nil {
+			err = d.loadBinString(n)
+		}
+
+	case opShortBinString:
+		var b []byte
+		if b, err = d.read(1); err == nil {
+			err = d.loadBinString(int(b[0]))
+		}
+
+	case opUnicode:
+		var s string
+		if s, err = d.readLine(); err != nil {
+			return
+		}
+		if s, err = decodeRawUnicodeEscape(s); err == nil {
+			d.push(s)
+		}
+
+	case opBinUnicode:
+		var n int
+		if n, err = d.readSize(); err != nil {
+			return
+		}
+
+		var b []byte
+		if b, err = d.read(n); err != nil {
+			return
+		}
+		if !utf8.Valid(b) {
+			return errors.New("pickle: invalid UTF-8 in unicode object")
+		}
+		d.push(string(b))
+
+	case opEmptyTuple:
+		d.push(tuple{})
+
+	case opTuple:
+		var items []interface{}
+		if items, err = d.popMark(); err == nil {
+			d.push(tuple(items))
+		}
+
+	case opTuple1, opTuple2, opTuple3:
+		n := int(op-opTuple1) + 1
+		if len(d.stack) < n {
+			return errStackUnderflow
+		}
+
+		items := make(tuple, n)
+		copy(items, d.stack[len(d.stack)-n:])
+		d.stack = d.stack[:len(d.stack)-n]
+		d.push(items)
+
+	case opEmptyList:
+		d.push(new(list))
+
+	case opList:
+		var items []interface{}
+		if items, err = d.popMark(); err == nil {
+			d.push(&list{items})
+		}
+
+	case opAppend:
+		var x interface{}
+		if x, err = d.pop(); err == nil {
+			err = d.appendItems(x)
+		}
+
+	case opAppends:
+		var items []interface{}
+		if items, err = d.popMark(); err == nil {
+			err = d.appendItems(items...)
+		}
+
+	case opEmptyDict:
+		d.push(new(dict))
+
+	case opDict:
+		var items []interface{}
+		if items, err = d.popMark(); err != nil {
+			return
+		}
+		if len(items)%2 != 0 {
+			return errors.New("pickle: odd number of items for DICT")
+		}
+		d.push(&dict{items})
+
+	case opSetItem:
+		if len(d.stack) < 2 {
+			return errStackUnderflow
+		}
+
+		items := make([]interface{}, 2)
+		copy(items, d.stack[len(d.stack)-2:])
+		d.stack = d.stack[:len(d.stack)-2]
+		err = d.setItems(items)
+
+	case opSetItems:
+		var items []interface{}
+		if items, err = d.popMark(); err != nil {
+			return
+		}
+		if len(items)%2 != 0 {
+			return errors.New("pickle: odd number of items for SETITEMS")
+		}
+		err = d.setItems(items)
+
+	case opGlobal:
+		err = d.loadGlobal()
+
+	case opReduce:
+		err = d.loadReduce()
+
+	case opBuild:
+		var state interface{}
+		if state, err = d.pop(); err != nil {
+			return
+		}
+		if state != nil {
+			return errors.New("pickle: object state is not supported")
+		}
+
+	case opPut:
+		var s string
+		if s, err = d.readLine(); err != nil {
+			return
+		}
+
+		var id int64
+		if id, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return fmt.Errorf("pickle: invalid memo key %q", s)
+		}
+		err = d.put(id)
+
+	case opBinPut:
+		var b []byte
+		if b, err = d.read(1); err == nil {
+			err = d.put(int64(b[0]))
+		}
+
+	case opLongBinPut:
+		var b []byte
+		if b, err = d.read(4); err == nil {
+			err = d.put(int64(binary.LittleEndian.Uint32(b)))
+		}
+
+	case opGet:
+		var s string
+		if s, err = d.readLine(); err != nil {
+			return
+		}
+
+		var id int64
+		if id, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return fmt.Errorf("pickle: invalid memo key %q", s)
+		}
+		err = d.get(id)
+
+	case opBinGet:
+		var b []byte
+		if b, err = d.read(1); err == nil {
+			err = d.get(int64(b[0]))
+		}
+
+	case opLongBinGet:
+		var b []byte
+		if b, err = d.read(4); err == nil {
+			err = d.get(int64(binary.LittleEndian.Uint32(b)))
+		}
+
+	case opProto:
+		var b []byte
+		if b, err = d.read(1); err == nil && b[0] > HighestProtocol {
+			err = fmt.Errorf("pickle: unsupported protocol %d", b[0])
+		}
+
+	case opInst, opObj, opNewObj:
+		err = errors.New("pickle: class instances are not supported")
+
+	case opPersID, opBinPersID:
+		err = errors.New("pickle: persistent IDs are not supported")
+
+	case opExt1, opExt2, opExt4:
+		err = errors.New("pickle: extension registry is not supported")
+
+	default:
+		err = fmt.Errorf("pickle: invalid opcode 0x%02x", op)
+	}
+	return
+}
+
+func (d *Decoder) push(x interface{}) {
+	d.stack = append(d.stack, x)
+}
+
+func (d *Decoder) top() (x interface{}, err error) {
+	n := len(d.stack)
+	if n == 0 || (len(d.marks) > 0 && d.marks[len(d.marks)-1] == n) {
+		err = errStackUnderflow
+		return
+	}
+
+	x = d.stack[n-1]
+	return
+}
+
+func (d *Decoder) pop() (x interface{}, err error) {
+	if x, err = d.top(); err == nil {
+		d.stack = d.stack[:len(d.stack)-1]
+	}
+	return
+}
+
+// popMark removes the items which were pushed after the latest mark.
+func (d *Decoder) popMark() (items []interface{}, err error) {
+	n := len(d.marks)
+	if n == 0 {
+		err = errMarkNotFound
+		return
+	}
+
+	i := d.marks[n-1]
+	d.marks = d.marks[:n-1]
+
+	items = make([]interface{}, len(d.stack)-i)
+	copy(items, d.stack[i:])
+	d.stack = d.stack[:i]
+	return
+}
+
+func (d *Decoder) appendItems(items ...interface{}) (err error) {
+	x, err := d.top()
+	if err != nil {
+		return
+	}
+
+	l, ok := x.(*list)
+	if !ok {
+		return errors.New("pickle: appending to a non-list object")
+	}
+
+	l.items = append(l.items, items...)
+	return
+}
+
+func (d *Decoder) setItems(items []interface{}) (err error) {
+	x, err := d.top()
+	if err != nil {
+		return
+	}
+
+	m, ok := x.(*dict)
+	if !ok {
+		return errors.New("pickle: setting items of a non-dict object")
+	}
+
+	m.items = append(m.items, items...)
+	return
+}
+
+func (d *Decoder) put(id int64) (err error) {
+	x, err := d.top()
+	if err == nil {
+		d.memo[id] = x
+	}
+	return
+}
+
+func (d *Decoder) get(id int64) error {
+	x, found := d.memo[id]
+	if !found {
+		return fmt.Errorf("pickle: memo key %d not found", id)
+	}
+
+	d.push(x)
+	return nil
+}
+
+// read exactly n bytes.  The returned slice is valid until the next read.
+func (d *Decoder) read(n int) (b []byte, err error) {
+	if n <= d.r.Size() {
+		if b, err = d.r.Peek(n); err == nil {
+			d.r.Discard(n)
+		}
+	} else {
+		b = make([]byte, n)
+		_, err = io.ReadFull(d.r, b)
+	}
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// readSize reads a 4-byte length.
+func (d *Decoder) readSize() (n int, err error) {
+	b, err := d.read(4)
+	if err != nil {
+		return
+	}
+
+	if n = int(int32(binary.LittleEndian.Uint32(b))); n < 0 {
+		err = errors.New("pickle: negative length")
+	}
+	return
+}
+
+// readLine reads a newline-terminated argument of a text opcode.
+func (d *Decoder) readLine() (s string, err error) {
+	if s, err = d.r.ReadString('\n'); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+
+	s = s[:len(s)-1]
+	return
+}
+
+func (d *Decoder) loadInt() (err error) {
+	s, err := d.readLine()
+	if err != nil {
+		return
+	}
+
+	switch s {
+	case "00":
+		d.push(false)
+		return
+
+	case "01":
+		d.push(true)
+		return
+	}
+
+	if i, e := strconv.ParseInt(s, 10, 64); e == nil && i == int64(int(i)) {
+		d.push(int(i))
+		return
+	}
+
+	// Doesn't fit in a Python int, so it becomes a long.
+	i, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return fmt.Errorf("pickle: invalid int %q", s)
+	}
+
+	d.push(long(i))
+	return
+}
+
+func (d *Decoder) loadLong() (err error) {
+	s, err := d.readLine()
+	if err != nil {
+		return
+	}
+
+	i, ok := new(big.Int).SetString(strings.TrimSuffix(s, "L"), 10)
+	if !ok {
+		return fmt.Errorf("pickle: invalid long %q", s)
+	}
+
+	d.push(long(i))
+	return
+}
+
+// loadBinLong decodes a little-endian two's complement integer.
+func (d *Decoder) loadBinLong(n int) (err error) {
+	b, err := d.read(n)
+	if err != nil {
+		return
+	}
+
+	be := make([]byte, n)
+	for i, c := range b {
+		be[n-1-i] = c
+	}
+
+	i := new(big.Int).SetBytes(be)
+	if n > 0 && be[0]&0x80 != 0 {
+		i.Sub(i, new(big.Int).Lsh(big.NewInt(1), uint(n*8)))
+	}
+
+	d.push(long(i))
+	return
+}
+
+// long translates a Python long to int64 or uint64 if it fits.
+func long(i *big.Int) interface{} {
+	switch {
+	case i.IsInt64():
+		return i.Int64()
+
+	case i.IsUint64():
+		return i.Uint64()
+
+	default:
+		return i
+	}
+}
+
+func (d *Decoder) loadString() (err error) {
+	s, err := d.readLine()
+	if err != nil {
+		return
+	}
+
+	if len(s) < 2 || (s[0] != '\'' && s[0] != '"') || s[len(s)-1] != s[0] {
+		return errors.New("pickle: insecure string")
+	}
+
+	if s, err = decodeStringEscape(s[1 : len(s)-1]); err == nil {
+		d.push(s)
+	}
+	return
+}
+
+func (d *Decoder) loadBinString(n int) (err error) {
+	b, err := d.read(n)
+	if err == nil {
+		d.push(string(b))
+	}
+	return
+}
+
+// decodeStringEscape interprets the escape sequences of a Python string
+// literal.
+func decodeStringEscape(s string) (string, error) {
+	b := make([]byte, 0, len(s))
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b = append(b, c)
+			continue
+		}
+
+		if i++; i == len(s) {
+			return "", errors.New("pickle: trailing backslash in string")
+		}
+
+		switch c = s[i]; c {
+		case '\n':
+			// Line continuation.
+
+		case '\\', '\'', '"':
+			b = append(b, c)
+
+		case 'a':
+			b = append(b, '\a')
+
+		case 'b':
+			b = append(b, '\b')
+
+		case 'f':
+			b = append(b, '\f')
+
+		case 'n':
+			b = append(b, '\n')
+
+		case 'r':
+			b = append(b, '\r')
+
+		case 't':
+			b = append(b, '\t')
+
+		case 'v':
+			b = append(b, '\v')
+
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			v := int(c - '0')
+			for j := 0; j < 2 && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '7'; j++ {
+				i++
+				v = v*8 + int(s[i]-'0')
+			}
+			b = append(b, byte(v))
+
+		case 'x':
+			if i+2 >= len(s) {
+				return "", errors.New("pickle: invalid \\x escape in string")
+			}
+
+			v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", errors.New("pickle: invalid \\x escape in string")
+			}
+			b = append(b, byte(v))
+			i += 2
+
+		default:
+			b = append(b, '\\', c)
+		}
+	}
+
+	return string(b), nil
+}
+
+// decodeRawUnicodeEscape decodes Python's raw-unicode-escape encoding to
+// UTF-8.
+func decodeRawUnicodeEscape(s string) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		if s[i] != '\\' {
+			b.WriteRune(rune(s[i]))
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(s) && s[j] == '\\' {
+			j++
+		}
+
+		// An escape begins with an odd number of backslashes.
+		n := j - i
+		if n%2 == 0 || j == len(s) || (s[j] != 'u' && s[j] != 'U') {
+			b.WriteString(s[i:j])
+			i = j
+			continue
+		}
+
+		b.WriteString(s[i : j-1])
+
+		digits := 4
+		if s[j] == 'U' {
+			digits = 8
+		}
+
+		if j+1+digits > len(s) {
+			return "", errors.New("pickle: truncated \\uXXXX escape in unicode")
+		}
+
+		v, err := strconv.ParseUint(s[j+1:j+1+digits], 16, 32)
+		if err != nil || v > unicode.MaxRune {
+			return "", errors.New("pickle: invalid \\uXXXX escape in unicode")
+		}
+
+		b.WriteRune(rune(v))
+		i = j + 1 + digits
+	}
+
+	return b.String(), nil
+}
+
+func (d *Decoder) loadGlobal() (err error) {
+	module, err := d.readLine()
+	if err != nil {
+		return
+	}
+
+	name, err := d.readLine()
+	if err != nil {
+		return
+	}
+
+	reduce, found := reducers[module+"."+name]
+	if !found {
+		return fmt.Errorf("pickle: unsupported class %s.%s", module, name)
+	}
+
+	d.push(&global{module, name, reduce})
+	return
+}
+
+func (d *Decoder) loadReduce() (err error) {
+	x, err := d.pop()
+	if err != nil {
+		return
+	}
+
+	args, ok := x.(tuple)
+	if !ok {
+		return errors.New("pickle: REDUCE arguments are not a tuple")
+	}
+
+	if x, err = d.pop(); err != nil {
+		return
+	}
+
+	g, ok := x.(*global)
+	if !ok {
+		return errors.New("pickle: REDUCE callable is not a class")
+	}
+
+	value, err := newConverter(false).convert(args)
+	if err != nil {
+		return
+	}
+
+	if value, err = g.reduce(value.([]interface{})); err != nil {
+		return fmt.Errorf("pickle: %s.%s: %v", g.module, g.name, err)
+	}
+
+	d.push(value)
+	return
+}
+
+// converter translates the intermediate representations to Go values.
+type converter struct {
+	typedSequences bool
+	done           map[interface{}]interface{}
+	busy           map[interface{}]bool
+}
+
+func newConverter(typedSequences bool) *converter {
+	return &converter{
+		typedSequences: typedSequences,
+		done:           make(map[interface{}]interface{}),
+		busy:           make(map[interface{}]bool),
+	}
+}
+
+func (c *converter) convert(x interface{}) (value interface{}, err error) {
+	switch x := x.(type) {
+	case tuple:
+		var items []interface{}
+
+		if items, err = c.convertItems(x); err != nil {
+			return
+		}
+
+		if c.typedSequences {
+			value = Tuple(items)
+		} else {
+			value = items
+		}
+
+	case *list, *dict:
+		var found bool
+
+		if value, found = c.done[x]; found {
+			return
+		}
+
+		if c.busy[x] {
+			err = errRecursive
+			return
+		}
+
+		c.busy[x] = true
+		value, err = c.convertMutable(x)
+		delete(c.busy, x)
+
+		if err == nil {
+			c.done[x] = value
+		}
+
+	case *global:
+		err = fmt.Errorf("pickle: unable to decode class %s.%s", x.module, x.name)
+
+	default:
+		value = x
+	}
+	return
+}
+
+func (c *converter) convertMutable(x interface{}) (value interface{}, err error) {
+	switch x := x.(type) {
+	case *list:
+		var items []interface{}
+
+		if items, err = c.convertItems(x.items); err != nil {
+			return
+		}
+
+		if c.typedSequences {
+			value = List(items)
+		} else {
+			value = items
+		}
+
+	case *dict:
+		var items []interface{}
+
+		if items, err = c.convertItems(x.items); err != nil {
+			return
+		}
+
+		m := make(map[interface{}]interface{}, len(items)/2)
+
+		for i := 0; i < len(items); i += 2 {
+			if err = checkKey(items[i]); err != nil {
+				return
+			}
+
+			m[items[i]] = items[i+1]
+		}
+
+		value = m
+	}
+	return
+}
+
+func (c *converter) convertItems(xs []interface{}) (items []interface{}, err error) {
+	items = make([]interface{}, len(xs))
+
+	for i, x := range xs {
+		if items[i], err = c.convert(x); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// checkKey returns an error if the value cannot be used as a Go map key.
+func checkKey(key interface{}) error {
+	if key != nil && !reflect.TypeOf(key).Comparable() {
+		return fmt.Errorf("pickle: unable to decode %T as a Go map key", key)
+	}
+	return nil
+}
+
+// reducers reconstruct the supported classes.
+var reducers = map[string]reducer{
+	"__builtin__.bytearray":   reduceByteArray,
+	"__builtin__.complex":     reduceComplex,
+	"__builtin__.frozenset":   reduceFrozenSet,
+	"__builtin__.set":         reduceSet,
+	"collections.OrderedDict": reduceOrderedDict,
+	"datetime.date":           reduceDate,
+	"datetime.datetime":       reduceDateTime,
+	"datetime.time":           reduceTime,
+	"datetime.timedelta":      reduceTimedelta,
+}
+
+func reduceByteArray(args []interface{}) (value interface{}, err error) {
+	switch len(args) {
+	case 0:
+		value = []byte{}
+		return
+
+	case 2:
+		s, ok := args[0].(string)
+		if !ok || args[1] != "latin-1" {
+			break
+		}
+
+		// The unicode object contains the bytes as code points.
+		b := make([]byte, 0, len(s))
+		for _, r := range s {
+			if r > 0xff {
+				err = errInvalidArgs
+				return
+			}
+			b = append(b, byte(r))
+		}
+
+		value = b
+		return
+	}
+
+	err = errInvalidArgs
+	return
+}
+
+func reduceComplex(args []interface{}) (value interface{}, err error) {
+	var parts [2]float64
+
+	if len(args) > len(parts) {
+		err = errInvalidArgs
+		return
+	}
+
+	for i, x := range args {
+		switch x := x.(type) {
+		case float64:
+			parts[i] = x
+
+		case int:
+			parts[i] = float64(x)
+
+		default:
+			err = errInvalidArgs
+			return
+		}
+	}
+
+	value = complex(parts[0], parts[1])
+	return
+}
+
+func reduceSet(args []interface{}) (value interface{}, err error) {
+	set, err := setItems(args)
+	if err == nil {
+		value = Set(set)
+	}
+	return
+}
+
+func reduceFrozenSet(args []interface{}) (value interface{}, err error) {
+	set, err := setItems(args)
+	if err == nil {
+		value = FrozenSet(set)
+	}
+	return
+}
+
+func setItems(args []interface{}) (set map[interface{}]struct{}, err error) {
+	set = make(map[interface{}]struct{})
+
+	switch len(args) {
+	case 0:
+		return
+
+	case 1:
+		items, ok := args[0].([]interface{})
+		if !ok {
+			break
+		}
+
+		for _, item := range items {
+			if err = checkKey(item); err != nil {
+				return
+			}
+			set[item] = struct{}{}
+		}
+		return
+	}
+
+	err = errInvalidArgs
+	return
+}
+
+func reduceOrderedDict(args []interface{}) (value interface{}, err error) {
+	m := make(map[interface{}]interface{})
+
+	switch len(args) {
+	case 0:
+		value = m
+		return
+
+	case 1:
+		items, ok := args[0].([]interface{})
+		if !ok {
+			break
+		}
+
+		for _, item := range items {
+			pair, ok := item.([]interface{})
+			if !ok || len(pair) != 2 {
+				err = errInvalidArgs
+				return
+			}
+
+			if err = checkKey(pair[0]); err != nil {
+				return
+			}
+			m[pair[0]] = pair[1]
+		}
+
+		value = m
+		return
+	}
+
+	err = errInvalidArgs
+	return
+}
+
+// dateTimeState gets the packed fields of a date, datetime or time object.
+// Aware objects are not supported.
+func dateTimeState(args []interface{}, size int) (b []byte, err error) {
+	if len(args) == 2 && args[1] != nil {
+		err = errors.New("aware objects are not supported")
+		return
+	}
+
+	if len(args) < 1 || len(args) > 2 {
+		err = errInvalidArgs
+		return
+	}
+
+	s, ok := args[0].(string)
+	if !ok || len(s) != size {
+		err = errInvalidArgs
+		return
+	}
+
+	b = []byte(s)
+	return
+}
+
+func reduceDateTime(args []interface{}) (value interface{}, err error) {
+	b, err := dateTimeState(args, 10)
+	if err != nil {
+		return
+	}
+
+	year := int(b[0])<<8 | int(b[1])
+	usecond := int(b[7])<<16 | int(b[8])<<8 | int(b[9])
+
+	value = time.Date(year, time.Month(b[2]), int(b[3]), int(b[4]), int(b[5]), int(b[6]), usecond*1000, time.Local)
+	return
+}
+
+func reduceDate(args []interface{}) (value interface{}, err error) {
+	if len(args) != 1 {
+		err = errInvalidArgs
+		return
+	}
+
+	b, err := dateTimeState(args, 4)
+	if err != nil {
+		return
+	}
+
+	value = Date{
+		Year:  int(b[0])<<8 | int(b[1]),
+		Month: time.Month(b[2]),
+		Day:   int(b[3]),
+	}
+	return
+}
+
+func reduceTime(args []interface{}) (value interface{}, err error) {
+	b, err := dateTimeState(args, 6)
+	if err != nil {
+		return
+	}
+
+	value = TimeOfDay{
+		Hour:        int(b[0]),
+		Minute:      int(b[1]),
+		Second:      int(b[2]),
+		Microsecond: int(b[3])<<16 | int(b[4])<<8 | int(b[5]),
+	}
+	return
+}
+
+func reduceTimedelta(args []interface{}) (value interface{}, err error) {
+	var parts [3]int64 // days, seconds, microseconds
+
+	if len(args) > len(parts) {
+		err = errInvalidArgs
+		return
+	}
+
+	for i, x := range args {
+		switch x := x.(type) {
+		case int:
+			parts[i] = int64(x)
+
+		case int64:
+			parts[i] = x
+
+		default:
+			err = errInvalidArgs
+			return
+		}
+	}
+
+	total := new(big.Int)
+
+	for i, unit := range [...]time.Duration{24 * time.Hour, time.Second, time.Microsecond} {
+		total.Add(total, new(big.Int).Mul(big.NewInt(parts[i]), big.NewInt(int64(unit))))
+	}
+
+	if !total.IsInt64() {
+		err = errors.New("timedelta is out of range")
+		return
+	}
+
+	value = time.Duration(total.Int64())
+	return
+}
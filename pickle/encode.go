@@ -0,0 +1,672 @@
+package pickle
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// batchSize is the maximum number of items per APPENDS or SETITEMS opcode.
+const batchSize = 1000
+
+// Encoder writes pickles to an output stream.
+type Encoder struct {
+	// UnicodeStrings makes the string type be pickled as unicode instead of
+	// str.
+	UnicodeStrings bool
+
+	// ListSlices makes []interface{} and other slices be pickled as list
+	// instead of tuple.
+	ListSlices bool
+
+	w        io.Writer
+	protocol int
+	buf      []byte
+}
+
+// NewEncoder writes to a stream using the given protocol version.  A negative
+// version selects HighestProtocol.
+func NewEncoder(w io.Writer, protocol int) *Encoder {
+	if protocol < 0 {
+		protocol = HighestProtocol
+	}
+
+	return &Encoder{
+		w:        w,
+		protocol: protocol,
+	}
+}
+
+// Encode writes a pickle.  Nothing is written if the value cannot be encoded.
+func (e *Encoder) Encode(value interface{}) (err error) {
+	if e.protocol > HighestProtocol {
+		return fmt.Errorf("pickle: unsupported protocol %d", e.protocol)
+	}
+
+	e.buf = e.buf[:0]
+
+	if e.protocol >= 2 {
+		e.buf = append(e.buf, opProto, byte(e.protocol))
+	}
+
+	if err = e.encode(value); err != nil {
+		return
+	}
+
+	e.buf = append(e.buf, opStop)
+
+	_, err = e.w.Write(e.buf)
+	return
+}
+
+func (e *Encoder) encode(x interface{}) (err error) {
+	if x == nil {
+		e.buf = append(e.buf, opNone)
+		return
+	}
+
+	switch value := x.(type) {
+	case bool:
+		e.bool(value)
+
+	case byte: // alias uint8
+		e.str(string([]byte{value}))
+
+	case complex64:
+		err = e.complex(complex128(value))
+
+	case complex128:
+		err = e.complex(value)
+
+	case float32:
+		e.float(float64(value))
+
+	case float64:
+		e.float(value)
+
+	case int: // alias rune
+		e.int(int64(value))
+
+	case int8:
+		e.int(int64(value))
+
+	case int16:
+		e.int(int64(value))
+
+	case int32:
+		e.int(int64(value))
+
+	case int64:
+		e.long(big.NewInt(value))
+
+	case string:
+		if e.UnicodeStrings {
+			err = e.unicode(value)
+		} else {
+			e.str(value)
+		}
+
+	case Bytes:
+		e.str(string(value))
+
+	case Unicode:
+		err = e.unicode(string(value))
+
+	case []byte:
+		e.str(string(value))
+
+	case ByteArray:
+		err = e.byteArray(value)
+
+	case uint:
+		e.long(new(big.Int).SetUint64(uint64(value)))
+
+	case uint16:
+		e.int(int64(value))
+
+	case uint32:
+		e.long(new(big.Int).SetUint64(uint64(value)))
+
+	case uint64:
+		e.long(new(big.Int).SetUint64(value))
+
+	case uintptr:
+		e.long(new(big.Int).SetUint64(uint64(value)))
+
+	case time.Time:
+		err = e.dateTime(value)
+
+	case Date:
+		err = e.date(value)
+
+	case TimeOfDay:
+		err = e.time(value)
+
+	case time.Duration:
+		err = e.timedelta(value)
+
+	case *big.Int:
+		if value == nil {
+			e.buf = append(e.buf, opNone)
+		} else {
+			e.long(value)
+		}
+
+	case big.Int:
+		e.long(&value)
+
+	case []interface{}:
+		if e.ListSlices {
+			err = e.list(value)
+		} else {
+			err = e.tuple(value)
+		}
+
+	case List:
+		err = e.list(value)
+
+	case Tuple:
+		err = e.tuple(value)
+
+	case Set:
+		err = e.set("set", value)
+
+	case FrozenSet:
+		err = e.set("frozenset", value)
+
+	case map[interface{}]interface{}:
+		err = e.dict(value)
+
+	default:
+		err = e.encodeReflect(reflect.ValueOf(x))
+	}
+	return
+}
+
+// encodeReflect handles named types, pointers, slices, maps and structs like
+// the python package does.  Structs are encoded as dicts.
+func (e *Encoder) encodeReflect(v reflect.Value) (err error) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return e.encode(nil)
+		}
+		return e.encode(v.Elem().Interface())
+
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr, reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String:
+		// Named type.
+		return e.encode(v.Convert(basicTypes[v.Kind()]).Interface())
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return e.encode(nil)
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Named byte slice or byte array.
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return e.encode(b)
+		}
+
+		array := make([]interface{}, v.Len())
+		for i := range array {
+			array[i] = v.Index(i).Interface()
+		}
+		return e.encode(array)
+
+	case reflect.Map:
+		if v.IsNil() {
+			return e.encode(nil)
+		}
+
+		m := make(map[interface{}]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			m[key.Interface()] = v.MapIndex(key).Interface()
+		}
+		return e.dict(m)
+
+	case reflect.Struct:
+		t := v.Type()
+		m := make(map[interface{}]interface{})
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue // unexported
+			}
+
+			name := f.Tag.Get("py")
+			switch name {
+			case "-":
+				continue
+
+			case "":
+				name = f.Name
+			}
+
+			m[name] = v.Field(i).Interface()
+		}
+		return e.dict(m)
+	}
+
+	return fmt.Errorf("pickle: unable to encode %T", v.Interface())
+}
+
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:       reflect.TypeOf(false),
+	reflect.Int:        reflect.TypeOf(int(0)),
+	reflect.Int8:       reflect.TypeOf(int8(0)),
+	reflect.Int16:      reflect.TypeOf(int16(0)),
+	reflect.Int32:      reflect.TypeOf(int32(0)),
+	reflect.Int64:      reflect.TypeOf(int64(0)),
+	reflect.Uint:       reflect.TypeOf(uint(0)),
+	reflect.Uint8:      reflect.TypeOf(uint8(0)),
+	reflect.Uint16:     reflect.TypeOf(uint16(0)),
+	reflect.Uint32:     reflect.TypeOf(uint32(0)),
+	reflect.Uint64:     reflect.TypeOf(uint64(0)),
+	reflect.Uintptr:    reflect.TypeOf(uintptr(0)),
+	reflect.Float32:    reflect.TypeOf(float32(0)),
+	reflect.Float64:    reflect.TypeOf(float64(0)),
+	reflect.Complex64:  reflect.TypeOf(complex64(0)),
+	reflect.Complex128: reflect.TypeOf(complex128(0)),
+	reflect.String:     reflect.TypeOf(""),
+}
+
+func (e *Encoder) line(op byte, arg string) {
+	e.buf = append(e.buf, op)
+	e.buf = append(e.buf, arg...)
+	e.buf = append(e.buf, '\n')
+}
+
+func (e *Encoder) uint32(n int) {
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, uint32(n))
+}
+
+func (e *Encoder) bool(b bool) {
+	switch {
+	case e.protocol >= 2 && b:
+		e.buf = append(e.buf, opNewTrue)
+
+	case e.protocol >= 2:
+		e.buf = append(e.buf, opNewFalse)
+
+	case b:
+		e.line(opInt, "01")
+
+	default:
+		e.line(opInt, "00")
+	}
+}
+
+// int encodes a Python int.
+func (e *Encoder) int(i int64) {
+	switch {
+	case e.protocol >= 1 && i >= 0 && i <= math.MaxUint8:
+		e.buf = append(e.buf, opBinInt1, byte(i))
+
+	case e.protocol >= 1 && i >= 0 && i <= math.MaxUint16:
+		e.buf = append(e.buf, opBinInt2)
+		e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(i))
+
+	case e.protocol >= 1 && i >= math.MinInt32 && i <= math.MaxInt32:
+		e.buf = append(e.buf, opBinInt)
+		e.buf = binary.LittleEndian.AppendUint32(e.buf, uint32(int32(i)))
+
+	default:
+		e.line(opInt, strconv.FormatInt(i, 10))
+	}
+}
+
+// long encodes a Python long.
+func (e *Encoder) long(i *big.Int) {
+	if e.protocol < 2 {
+		e.line(opLong, i.String()+"L")
+		return
+	}
+
+	// Little-endian two's complement with a sign bit.
+	var b []byte
+
+	switch i.Sign() {
+	case 1:
+		b = i.FillBytes(make([]byte, i.BitLen()/8+1))
+
+	case -1:
+		n := new(big.Int).Not(i).BitLen()/8 + 1
+		u := new(big.Int).Lsh(big.NewInt(1), uint(n*8))
+		b = u.Add(u, i).FillBytes(make([]byte, n))
+	}
+
+	for l, r := 0, len(b)-1; l < r; l, r = l+1, r-1 {
+		b[l], b[r] = b[r], b[l]
+	}
+
+	if len(b) <= math.MaxUint8 {
+		e.buf = append(e.buf, opLong1, byte(len(b)))
+	} else {
+		e.buf = append(e.buf, opLong4)
+		e.uint32(len(b))
+	}
+	e.buf = append(e.buf, b...)
+}
+
+func (e *Encoder) float(f float64) {
+	if e.protocol >= 1 {
+		e.buf = append(e.buf, opBinFloat)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(f))
+	} else {
+		e.line(opFloat, strconv.FormatFloat(f, 'g', -1, 64))
+	}
+}
+
+func (e *Encoder) complex(c complex128) error {
+	return e.reduce("__builtin__", "complex", real(c), imag(c))
+}
+
+// str encodes a Python str.
+func (e *Encoder) str(s string) {
+	switch {
+	case e.protocol == 0:
+		e.line(opString, quote(s))
+
+	case len(s) <= math.MaxUint8:
+		e.buf = append(e.buf, opShortBinString, byte(len(s)))
+		e.buf = append(e.buf, s...)
+
+	default:
+		e.buf = append(e.buf, opBinString)
+		e.uint32(len(s))
+		e.buf = append(e.buf, s...)
+	}
+}
+
+// quote formats a Python string literal.
+func quote(s string) string {
+	const hex = "0123456789abcdef"
+
+	b := make([]byte, 0, len(s)+2)
+	b = append(b, '\'')
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '\'':
+			b = append(b, '\\', c)
+
+		case '\t':
+			b = append(b, '\\', 't')
+
+		case '\n':
+			b = append(b, '\\', 'n')
+
+		case '\r':
+			b = append(b, '\\', 'r')
+
+		default:
+			if c < 0x20 || c >= 0x7f {
+				b = append(b, '\\', 'x', hex[c>>4], hex[c&0xf])
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+
+	b = append(b, '\'')
+	return string(b)
+}
+
+// unicode encodes a Python unicode object.
+func (e *Encoder) unicode(s string) error {
+	if !utf8.ValidString(s) {
+		return errors.New("pickle: string is not valid UTF-8")
+	}
+
+	if e.protocol >= 1 {
+		e.buf = append(e.buf, opBinUnicode)
+		e.uint32(len(s))
+		e.buf = append(e.buf, s...)
+		return nil
+	}
+
+	// Raw-unicode-escape, with backslashes and newlines escaped.
+	e.buf = append(e.buf, opUnicode)
+
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '\n':
+			e.buf = fmt.Appendf(e.buf, "\\u%04x", r)
+
+		case r <= 0xff:
+			e.buf = append(e.buf, byte(r))
+
+		case r <= 0xffff:
+			e.buf = fmt.Appendf(e.buf, "\\u%04x", r)
+
+		default:
+			e.buf = fmt.Appendf(e.buf, "\\U%08x", r)
+		}
+	}
+
+	e.buf = append(e.buf, '\n')
+	return nil
+}
+
+// byteArray encodes a Python bytearray like Python does: the bytes are
+// stored as the code points of a unicode object.
+func (e *Encoder) byteArray(b []byte) error {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+
+	return e.reduce("__builtin__", "bytearray", Unicode(runes), Bytes("latin-1"))
+}
+
+func (e *Encoder) tuple(items []interface{}) (err error) {
+	switch {
+	case len(items) == 0 && e.protocol >= 1:
+		e.buf = append(e.buf, opEmptyTuple)
+		return
+
+	case len(items) <= 3 && e.protocol >= 2:
+		for _, item := range items {
+			if err = e.encode(item); err != nil {
+				return
+			}
+		}
+
+		e.buf = append(e.buf, opTuple1+byte(len(items)-1))
+		return
+	}
+
+	e.buf = append(e.buf, opMark)
+
+	for _, item := range items {
+		if err = e.encode(item); err != nil {
+			return
+		}
+	}
+
+	e.buf = append(e.buf, opTuple)
+	return
+}
+
+func (e *Encoder) list(items []interface{}) (err error) {
+	if e.protocol == 0 {
+		e.buf = append(e.buf, opMark, opList)
+
+		for _, item := range items {
+			if err = e.encode(item); err != nil {
+				return
+			}
+			e.buf = append(e.buf, opAppend)
+		}
+		return
+	}
+
+	e.buf = append(e.buf, opEmptyList)
+
+	for len(items) > 0 {
+		n := len(items)
+		if n > batchSize {
+			n = batchSize
+		}
+
+		if n > 1 {
+			e.buf = append(e.buf, opMark)
+		}
+
+		for _, item := range items[:n] {
+			if err = e.encode(item); err != nil {
+				return
+			}
+		}
+
+		if n > 1 {
+			e.buf = append(e.buf, opAppends)
+		} else {
+			e.buf = append(e.buf, opAppend)
+		}
+
+		items = items[n:]
+	}
+	return
+}
+
+func (e *Encoder) dict(m map[interface{}]interface{}) (err error) {
+	if e.protocol == 0 {
+		e.buf = append(e.buf, opMark, opDict)
+
+		for key, value := range m {
+			if err = e.encode(key); err != nil {
+				return
+			}
+			if err = e.encode(value); err != nil {
+				return
+			}
+			e.buf = append(e.buf, opSetItem)
+		}
+		return
+	}
+
+	e.buf = append(e.buf, opEmptyDict)
+
+	keys := make([]interface{}, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > batchSize {
+			n = batchSize
+		}
+
+		if n > 1 {
+			e.buf = append(e.buf, opMark)
+		}
+
+		for _, key := range keys[:n] {
+			if err = e.encode(key); err != nil {
+				return
+			}
+			if err = e.encode(m[key]); err != nil {
+				return
+			}
+		}
+
+		if n > 1 {
+			e.buf = append(e.buf, opSetItems)
+		} else {
+			e.buf = append(e.buf, opSetItem)
+		}
+
+		keys = keys[n:]
+	}
+	return
+}
+
+func (e *Encoder) set(name string, set map[interface{}]struct{}) error {
+	items := make(List, 0, len(set))
+	for item := range set {
+		items = append(items, item)
+	}
+
+	return e.reduce("__builtin__", name, items)
+}
+
+// dateTime encodes a time as a naive datetime object in the local time zone.
+func (e *Encoder) dateTime(t time.Time) error {
+	t = t.In(time.Local)
+
+	year, month, day := t.Date()
+	hour, minute, second := t.Clock()
+	usecond := t.Nanosecond() / 1000
+
+	if year < 1 || year > 9999 {
+		return fmt.Errorf("pickle: year %d is out of range", year)
+	}
+
+	state := []byte{
+		byte(year >> 8), byte(year), byte(month), byte(day),
+		byte(hour), byte(minute), byte(second),
+		byte(usecond >> 16), byte(usecond >> 8), byte(usecond),
+	}
+
+	return e.reduce("datetime", "datetime", Bytes(state))
+}
+
+func (e *Encoder) date(d Date) error {
+	if d.Year < 1 || d.Year > 9999 {
+		return fmt.Errorf("pickle: year %d is out of range", d.Year)
+	}
+
+	state := []byte{byte(d.Year >> 8), byte(d.Year), byte(d.Month), byte(d.Day)}
+
+	return e.reduce("datetime", "date", Bytes(state))
+}
+
+func (e *Encoder) time(t TimeOfDay) error {
+	if t.Location != nil {
+		return errors.New("pickle: unable to encode aware TimeOfDay")
+	}
+
+	state := []byte{
+		byte(t.Hour), byte(t.Minute), byte(t.Second),
+		byte(t.Microsecond >> 16), byte(t.Microsecond >> 8), byte(t.Microsecond),
+	}
+
+	return e.reduce("datetime", "time", Bytes(state))
+}
+
+// timedelta encodes a duration.  Precision is truncated to microseconds.
+func (e *Encoder) timedelta(d time.Duration) error {
+	days := d / (24 * time.Hour)
+	seconds := (d % (24 * time.Hour)) / time.Second
+	useconds := (d % time.Second) / time.Microsecond
+
+	return e.reduce("datetime", "timedelta", int(days), int(seconds), int(useconds))
+}
+
+// reduce encodes a call of a global callable.
+func (e *Encoder) reduce(module, name string, args ...interface{}) (err error) {
+	e.buf = append(e.buf, opGlobal)
+	e.buf = append(e.buf, module...)
+	e.buf = append(e.buf, '\n')
+	e.buf = append(e.buf, name...)
+	e.buf = append(e.buf, '\n')
+
+	if err = e.tuple(args); err != nil {
+		return
+	}
+
+	e.buf = append(e.buf, opReduce)
+	return
+}
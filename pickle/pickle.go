@@ -0,0 +1,139 @@
+// Package pickle reads and writes Python 2.7 pickles (protocols 0, 1 and 2)
+// without the Python interpreter.
+//
+// Pickled objects are translated to the same Go values as the python package
+// translates live Python objects to:
+//
+//	None                        nil
+//	bool                        bool
+//	int                         int
+//	long                        int64, uint64 or *big.Int (whichever fits)
+//	float                       float64
+//	complex                     complex128
+//	str, unicode                string
+//	bytearray                   []byte
+//	tuple, list                 []interface{} (or Tuple, List)
+//	dict, OrderedDict           map[interface{}]interface{}
+//	set                         Set
+//	frozenset                   FrozenSet
+//	datetime.datetime           time.Time (naive, in the local time zone)
+//	datetime.date               Date
+//	datetime.time               TimeOfDay (naive)
+//	datetime.timedelta          time.Duration
+//
+// Instances of other classes are not supported.  Go values are pickled like
+// the python package translates them to Python objects.  The container types
+// are the same types as those of the python package.
+package pickle
+
+import (
+	"bytes"
+
+	"github.com/tsavola/go-python/internal/types"
+)
+
+// HighestProtocol is the newest protocol version supported by Python 2.7.
+const HighestProtocol = 2
+
+// Bytes is pickled as str.  It is the same type as python.Bytes.
+type Bytes = types.Bytes
+
+// Unicode is pickled as unicode.  It is the same type as python.Unicode.
+type Unicode = types.Unicode
+
+// List is pickled as list.  It is the same type as python.List.
+type List = types.List
+
+// Tuple is pickled as tuple.  It is the same type as python.Tuple.
+type Tuple = types.Tuple
+
+// Set is pickled as set.  It is the same type as python.Set.
+type Set = types.Set
+
+// FrozenSet is pickled as frozenset.  It is the same type as python.FrozenSet.
+type FrozenSet = types.FrozenSet
+
+// ByteArray is pickled as bytearray.  It is the same type as python.ByteArray.
+type ByteArray = types.ByteArray
+
+// Date is pickled as datetime.date.  It is the same type as python.Date.
+type Date = types.Date
+
+// TimeOfDay is pickled as datetime.time.  It is the same type as
+// python.TimeOfDay.  Aware times (with a Location) are not supported.
+type TimeOfDay = types.TimeOfDay
+
+// Unmarshal decodes a pickle.
+func Unmarshal(data []byte) (value interface{}, err error) {
+	return NewDecoder(bytes.NewReader(data)).Decode()
+}
+
+// Marshal encodes a value using the given protocol version.
+func Marshal(value interface{}, protocol int) (data []byte, err error) {
+	var b bytes.Buffer
+
+	if err = NewEncoder(&b, protocol).Encode(value); err != nil {
+		return
+	}
+
+	data = b.Bytes()
+	return
+}
+
+// Opcodes of protocols 0, 1 and 2.
+const (
+	opMark           = '('
+	opStop           = '.'
+	opPop            = '0'
+	opPopMark        = '1'
+	opDup            = '2'
+	opFloat          = 'F'
+	opInt            = 'I'
+	opBinInt         = 'J'
+	opBinInt1        = 'K'
+	opLong           = 'L'
+	opBinInt2        = 'M'
+	opNone           = 'N'
+	opPersID         = 'P'
+	opBinPersID      = 'Q'
+	opReduce         = 'R'
+	opString         = 'S'
+	opBinString      = 'T'
+	opShortBinString = 'U'
+	opUnicode        = 'V'
+	opBinUnicode     = 'X'
+	opAppend         = 'a'
+	opBuild          = 'b'
+	opGlobal         = 'c'
+	opDict           = 'd'
+	opEmptyDict      = '}'
+	opAppends        = 'e'
+	opGet            = 'g'
+	opBinGet         = 'h'
+	opInst           = 'i'
+	opLongBinGet     = 'j'
+	opList           = 'l'
+	opEmptyList      = ']'
+	opObj            = 'o'
+	opPut            = 'p'
+	opBinPut         = 'q'
+	opLongBinPut     = 'r'
+	opSetItem        = 's'
+	opTuple          = 't'
+	opEmptyTuple     = ')'
+	opSetItems       = 'u'
+	opBinFloat       = 'G'
+
+	opProto    = 0x80
+	opNewObj   = 0x81
+	opExt1     = 0x82
+	opExt2     = 0x83
+	opExt4     = 0x84
+	opTuple1   = 0x85
+	opTuple2   = 0x86
+	opTuple3   = 0x87
+	opNewTrue  = 0x88
+	opNewFalse = 0x89
+	opLong1    = 0x8a
+	opLong4    = 0x8b
+)
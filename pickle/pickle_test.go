@@ -0,0 +1,323 @@
+package pickle_test
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsavola/go-python"
+	"github.com/tsavola/go-python/pickle"
+)
+
+var expressions = []string{
+	`None`,
+	`True`,
+	`False`,
+	`0`,
+	`1`,
+	`-1`,
+	`255`,
+	`256`,
+	`65536`,
+	`-2147483648`,
+	`2147483647`,
+	`2147483648`,
+	`2**62`,
+	`0L`,
+	`1L`,
+	`-1L`,
+	`255L`,
+	`-256L`,
+	`-2**63`,
+	`2**63`,
+	`2**64-1`,
+	`2**64`,
+	`-2**100`,
+	`2**2100`,
+	`1.5`,
+	`-0.25`,
+	`1e300`,
+	`float("inf")`,
+	`1+2j`,
+	`""`,
+	`"abc"`,
+	`"a'b\"\n\r\t\\\x00\x7f\xff"`,
+	`"x" * 300`,
+	`u"abc"`,
+	`u"\u20ac\n\\\xe4\\u0041"`,
+	`u"\U0001f600"`,
+	`()`,
+	`(1,)`,
+	`(1, 2)`,
+	`(1, 2, 3)`,
+	`(1, 2, 3, 4)`,
+	`[]`,
+	`[1]`,
+	`[1, [2, 3], (4, [])]`,
+	`range(2500)`,
+	`{}`,
+	`{1: "a"}`,
+	`{1: "a", "b": [2.5], None: {}}`,
+	`dict((i, str(i)) for i in range(2500))`,
+	`(lambda x: [x, (x, x)])([1, 2])`,
+	`set()`,
+	`set([1, "a", 2**40, 2**63])`,
+	`frozenset([3])`,
+	`bytearray()`,
+	`bytearray("a\x00\xff")`,
+	`datetime.datetime(2020, 1, 2, 3, 4, 5, 6)`,
+	`datetime.date(1999, 12, 31)`,
+	`datetime.time(23, 59, 58, 999999)`,
+	`datetime.timedelta(-1, 2, 3)`,
+	`[datetime.timedelta(days=1000)] * 2`,
+	`collections.OrderedDict([(1, 2), (3, 4)])`,
+}
+
+func eval(t *testing.T, builtin python.Object, expr string) python.Object {
+	t.Helper()
+
+	globals := make(map[interface{}]interface{})
+	for _, name := range []string{"collections", "datetime"} {
+		module, err := python.Import(nil, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		globals[name] = module
+	}
+
+	o, err := builtin.Call(nil, "eval", expr, globals)
+	if err != nil {
+		t.Fatalf("%s: %v", expr, err)
+	}
+	return o
+}
+
+func TestCrossCheck(t *testing.T) {
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cPickle, err := python.Import(nil, "cPickle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expr := range expressions {
+		o := eval(t, builtin, expr)
+
+		var want interface{}
+
+		if o != nil {
+			if want, err = o.Value(nil); err != nil {
+				t.Fatalf("%s: %v", expr, err)
+			}
+		}
+
+		for protocol := 0; protocol <= pickle.HighestProtocol; protocol++ {
+			data, err := cPickle.CallValue(nil, "dumps", o, protocol)
+			if err != nil {
+				t.Fatalf("%s: %v", expr, err)
+			}
+
+			got, err := pickle.Unmarshal([]byte(data.(string)))
+			if err != nil {
+				t.Errorf("%s protocol %d: decode: %v", expr, protocol, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s protocol %d: decoded %#v, expected %#v", expr, protocol, got, want)
+			}
+
+			// []byte would be encoded as str.
+			value := want
+			if b, ok := value.([]byte); ok {
+				value = pickle.ByteArray(b)
+			}
+
+			encoded, err := pickle.Marshal(value, protocol)
+			if err != nil {
+				t.Errorf("%s protocol %d: encode: %v", expr, protocol, err)
+				continue
+			}
+
+			loaded, err := cPickle.CallValue(nil, "loads", python.Bytes(encoded))
+			if err != nil {
+				t.Errorf("%s protocol %d: cPickle.loads(%q): %v", expr, protocol, encoded, err)
+				continue
+			}
+			if !reflect.DeepEqual(loaded, want) {
+				t.Errorf("%s protocol %d: cPickle loaded %#v, expected %#v", expr, protocol, loaded, want)
+			}
+		}
+	}
+}
+
+func TestTypes(t *testing.T) {
+	cPickle, err := python.Import(nil, "cPickle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type named int
+	type blob []byte
+
+	for protocol := 0; protocol <= pickle.HighestProtocol; protocol++ {
+		var buf bytes.Buffer
+
+		e := pickle.NewEncoder(&buf, protocol)
+		e.UnicodeStrings = true
+		e.ListSlices = true
+
+		value := []interface{}{
+			"s",
+			pickle.Bytes("b"),
+			pickle.Tuple{named(1)},
+			[]string{"x"},
+			blob("xy"),
+			[2]byte{'a', 'b'},
+			struct {
+				Foo int
+				Bar int `py:"bar"`
+				Baz int `py:"-"`
+			}{1, 2, 3},
+		}
+
+		if err := e.Encode(value); err != nil {
+			t.Fatal(err)
+		}
+
+		o, err := cPickle.Call(nil, "loads", python.Bytes(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := builtin.CallValue(nil, "repr", o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := r.(string); s != `[u's', 'b', (1,), [u'x'], 'xy', 'ab', {u'Foo': 1, u'bar': 2}]` && s != `[u's', 'b', (1,), [u'x'], 'xy', 'ab', {u'bar': 2, u'Foo': 1}]` {
+			t.Errorf("protocol %d: %s", protocol, s)
+		}
+
+		d := pickle.NewDecoder(bytes.NewReader(buf.Bytes()))
+		d.TypedSequences = true
+
+		decoded, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := pickle.List{
+			"s",
+			"b",
+			pickle.Tuple{1},
+			pickle.List{"x"},
+			"xy",
+			"ab",
+			map[interface{}]interface{}{"Foo": 1, "bar": 2},
+		}
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("protocol %d: %#v", protocol, decoded)
+		}
+
+		if _, err := d.Decode(); err != io.EOF {
+			t.Errorf("protocol %d: %v", protocol, err)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	cPickle, err := python.Import(nil, "cPickle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	pickler, err := cPickle.Call(nil, "Pickler", python.File(&buf), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared := []interface{}{1, 2}
+
+	for _, value := range []interface{}{shared, shared} {
+		if _, err := pickler.Call(nil, "dump", python.List{value}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := pickle.NewDecoder(&buf)
+
+	for i := 0; i < 2; i++ {
+		value, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(value, []interface{}{[]interface{}{1, 2}}) {
+			t.Errorf("%d: %#v", i, value)
+		}
+	}
+
+	if _, err := d.Decode(); err != io.EOF {
+		t.Error(err)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cPickle, err := python.Import(nil, "cPickle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expr := range []string{
+		`__import__("decimal").Decimal("1.5")`,
+		`(lambda l: l.append(l) or l)([])`,
+		`{(1, 2): 3}`,
+		`__import__("fractions").Fraction(1, 2)`,
+		`datetime.timedelta(106751, 86399)`,
+	} {
+		o := eval(t, builtin, expr)
+
+		for protocol := 0; protocol <= pickle.HighestProtocol; protocol++ {
+			data, err := cPickle.CallValue(nil, "dumps", o, protocol)
+			if err != nil {
+				t.Fatalf("%s: %v", expr, err)
+			}
+
+			if value, err := pickle.Unmarshal([]byte(data.(string))); err == nil {
+				t.Errorf("%s protocol %d: %#v", expr, protocol, value)
+			} else {
+				t.Logf("%s protocol %d: %v", expr, protocol, err)
+			}
+		}
+	}
+
+	for _, data := range []string{"", "N", "\x80\x03N.", "(.", "a.", "I1", "S'abc\n."} {
+		if value, err := pickle.Unmarshal([]byte(data)); err == nil {
+			t.Errorf("%q: %#v", data, value)
+		} else if !strings.HasPrefix(err.Error(), "pickle: ") && err != io.EOF && err != io.ErrUnexpectedEOF {
+			t.Errorf("%q: %v", data, err)
+		}
+	}
+
+	for _, value := range []interface{}{func() {}, pickle.TimeOfDay{Location: time.UTC}} {
+		if _, err := pickle.Marshal(value, 2); err == nil {
+			t.Errorf("%#v", value)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package python
+
+import (
+	"compress/gzip"
+	"io"
+	"runtime"
+	"time"
+)
+
+// WriteProfile writes the statistics in the format of pprof (gzip-compressed
+// protocol buffer), so that they can be analyzed with "go tool pprof".  The
+// samples are call stacks which consist of Python frames followed by the Go
+// frames which called into Python.  Each stack is sampled once with its call
+// count and self time; pprof derives the cumulative times.
+func (p *Profiler) WriteProfile(w io.Writer) (err error) {
+	p.lock.Lock()
+	b := newPprofBuilder()
+	b.build(p)
+	p.lock.Unlock()
+
+	z := gzip.NewWriter(w)
+
+	if _, err = z.Write(b.profile.data); err != nil {
+		return
+	}
+
+	return z.Close()
+}
+
+// Field numbers of profile.proto.
+const (
+	profileSampleType        = 1
+	profileSample            = 2
+	profileMapping           = 3
+	profileLocation          = 4
+	profileFunctions         = 5
+	profileStringTable       = 6
+	profileTimeNanos         = 9
+	profileDurationNanos     = 10
+	profilePeriodType        = 11
+	profilePeriod            = 12
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	mappingID              = 1
+	mappingFilename        = 5
+	mappingHasFunctions    = 7
+	mappingHasFilenames    = 8
+	mappingHasLineNumbers  = 9
+	mappingHasInlineFrames = 10
+
+	locationID        = 1
+	locationMappingID = 2
+	locationAddress   = 3
+	locationLine      = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID        = 1
+	functionName      = 2
+	functionFilename  = 4
+	functionStartLine = 5
+)
+
+type pprofBuilder struct {
+	profile    protobuf
+	strings    map[string]int64
+	pyLocs     map[*profileFunction]uint64
+	goLocs     map[uintptr]uint64
+	goFuncs    map[string]uint64
+	nextLoc    uint64
+	nextFunc   uint64
+	locationID []uint64 // scratch
+}
+
+func newPprofBuilder() *pprofBuilder {
+	b := &pprofBuilder{
+		strings: make(map[string]int64),
+		pyLocs:  make(map[*profileFunction]uint64),
+		goLocs:  make(map[uintptr]uint64),
+		goFuncs: make(map[string]uint64),
+	}
+	b.string("")
+	return b
+}
+
+func (b *pprofBuilder) build(p *Profiler) {
+	b.valueType(profileSampleType, "calls", "count")
+	b.valueType(profileSampleType, "time", "nanoseconds")
+
+	b.profile.message(profileMapping, func(m *protobuf) {
+		m.uint64(mappingID, 1)
+		m.int64(mappingFilename, b.string("python"))
+		m.bool(mappingHasFunctions, true)
+		m.bool(mappingHasFilenames, true)
+		m.bool(mappingHasLineNumbers, true)
+		m.bool(mappingHasInlineFrames, true)
+	})
+
+	for _, root := range p.roots {
+		for _, n := range root.children {
+			b.samples(n)
+		}
+	}
+
+	b.profile.int64(profileTimeNanos, p.start.UnixNano())
+	b.profile.int64(profileDurationNanos, int64(time.Since(p.start)))
+	b.valueType(profilePeriodType, "time", "nanoseconds")
+	b.profile.int64(profilePeriod, 1)
+	b.profile.int64(profileDefaultSampleType, b.string("time"))
+}
+
+// samples adds a sample for the node and its descendants.
+func (b *pprofBuilder) samples(n *profileNode) {
+	if n.calls > 0 {
+		ids := b.locationID[:0]
+
+		frame := n
+		for ; frame.parent != nil; frame = frame.parent {
+			ids = append(ids, b.pyLocation(frame.fn))
+		}
+
+		for _, pc := range frame.goStack {
+			ids = append(ids, b.goLocation(pc))
+		}
+
+		b.locationID = ids
+
+		b.profile.message(profileSample, func(m *protobuf) {
+			m.packed(sampleLocationID, ids)
+			m.packedInt64(sampleValue, n.calls, int64(n.self))
+		})
+	}
+
+	for _, c := range n.children {
+		b.samples(c)
+	}
+}
+
+func (b *pprofBuilder) pyLocation(fn *profileFunction) uint64 {
+	id := b.pyLocs[fn]
+	if id == 0 {
+		funcID := b.function(fn.Name, fn.Filename, int64(fn.Line))
+		id = b.location(0, []pprofLine{{funcID, int64(fn.Line)}})
+		b.pyLocs[fn] = id
+	}
+	return id
+}
+
+func (b *pprofBuilder) goLocation(pc uintptr) uint64 {
+	id := b.goLocs[pc]
+	if id == 0 {
+		var lines []pprofLine
+
+		frames := runtime.CallersFrames([]uintptr{pc})
+		for {
+			frame, more := frames.Next()
+
+			key := frame.Function + "\x00" + frame.File
+			funcID := b.goFuncs[key]
+			if funcID == 0 {
+				var start int64
+				if frame.Func != nil {
+					_, line := frame.Func.FileLine(frame.Func.Entry())
+					start = int64(line)
+				}
+
+				funcID = b.function(frame.Function, frame.File, start)
+				b.goFuncs[key] = funcID
+			}
+
+			lines = append(lines, pprofLine{funcID, int64(frame.Line)})
+
+			if !more {
+				break
+			}
+		}
+
+		id = b.location(uint64(pc), lines)
+		b.goLocs[pc] = id
+	}
+	return id
+}
+
+type pprofLine struct {
+	funcID uint64
+	line   int64
+}
+
+func (b *pprofBuilder) location(address uint64, lines []pprofLine) uint64 {
+	b.nextLoc++
+	id := b.nextLoc
+
+	b.profile.message(profileLocation, func(m *protobuf) {
+		m.uint64(locationID, id)
+		m.uint64(locationMappingID, 1)
+		m.uint64(locationAddress, address)
+
+		for _, l := range lines {
+			m.message(locationLine, func(m *protobuf) {
+				m.uint64(lineFunctionID, l.funcID)
+				m.int64(lineLine, l.line)
+			})
+		}
+	})
+	return id
+}
+
+func (b *pprofBuilder) function(name, filename string, startLine int64) uint64 {
+	b.nextFunc++
+	id := b.nextFunc
+
+	b.profile.message(profileFunctions, func(m *protobuf) {
+		m.uint64(functionID, id)
+		m.int64(functionName, b.string(name))
+		m.int64(functionFilename, b.string(filename))
+		m.int64(functionStartLine, startLine)
+	})
+	return id
+}
+
+func (b *pprofBuilder) valueType(field int, typ, unit string) {
+	b.profile.message(field, func(m *protobuf) {
+		m.int64(valueTypeType, b.string(typ))
+		m.int64(valueTypeUnit, b.string(unit))
+	})
+}
+
+// string gets the index of a string in the string table.  New strings are
+// appended to the profile message.
+func (b *pprofBuilder) string(s string) int64 {
+	i, found := b.strings[s]
+	if !found {
+		i = int64(len(b.strings))
+		b.strings[s] = i
+		b.profile.bytes(profileStringTable, []byte(s))
+	}
+	return i
+}
+
+// protobuf encodes a protocol buffer message.  Repeated fields need not be
+// contiguous, so messages can be written in any order.
+type protobuf struct {
+	data []byte
+}
+
+func (b *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protobuf) key(field, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protobuf) uint64(field int, x uint64) {
+	if x != 0 {
+		b.key(field, 0)
+		b.varint(x)
+	}
+}
+
+func (b *protobuf) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *protobuf) bool(field int, x bool) {
+	if x {
+		b.uint64(field, 1)
+	}
+}
+
+func (b *protobuf) bytes(field int, x []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(x)))
+	b.data = append(b.data, x...)
+}
+
+func (b *protobuf) packed(field int, xs []uint64) {
+	var m protobuf
+	for _, x := range xs {
+		m.varint(x)
+	}
+	b.bytes(field, m.data)
+}
+
+func (b *protobuf) packedInt64(field int, xs ...int64) {
+	var m protobuf
+	for _, x := range xs {
+		m.varint(uint64(x))
+	}
+	b.bytes(field, m.data)
+}
+
+func (b *protobuf) message(field int, f func(*protobuf)) {
+	var m protobuf
+	f(&m)
+	b.bytes(field, m.data)
+}
@@ -0,0 +1,385 @@
+package python
+
+/*
+
+#include <Python.h>
+#include <frameobject.h>
+
+#include <stdint.h>
+
+extern void goProfileEnter(uintptr_t handle, void *key, void *type, void *object);
+extern void goProfileLeave(uintptr_t handle);
+
+static int profile(PyObject *obj, PyFrameObject *frame, int what, PyObject *arg) {
+	uintptr_t handle = (uintptr_t) PyLong_AsVoidPtr(obj);
+
+	switch (what) {
+	case PyTrace_CALL:
+		goProfileEnter(handle, frame->f_code, NULL, frame);
+		break;
+
+	case PyTrace_RETURN:
+		goProfileLeave(handle);
+		break;
+
+	case PyTrace_C_CALL:
+		if (PyCFunction_Check(arg)) {
+			PyObject *self = PyCFunction_GET_SELF(arg);
+			PyTypeObject *type = NULL;
+
+			if (self && !PyModule_Check(self)) {
+				type = Py_TYPE(self);
+			}
+
+			goProfileEnter(handle, ((PyCFunctionObject *) arg)->m_ml, type, arg);
+		}
+		break;
+
+	case PyTrace_C_RETURN:
+	case PyTrace_C_EXCEPTION:
+		if (PyCFunction_Check(arg)) {
+			goProfileLeave(handle);
+		}
+		break;
+	}
+
+	return 0;
+}
+
+static int setProfile(uintptr_t handle) {
+	PyObject *obj;
+
+	if (handle == 0) {
+		PyEval_SetProfile(NULL, NULL);
+		return 0;
+	}
+
+	obj = PyLong_FromVoidPtr((void *) handle);
+	if (obj == NULL) {
+		return -1;
+	}
+
+	PyEval_SetProfile(profile, obj);
+	Py_DECREF(obj);
+	return 0;
+}
+
+// describeFunction gets the name and location of a Python frame's function or
+// a built-in function.  The type is the type of the built-in method's self
+// object, or NULL.
+static void describeFunction(PyObject *o, PyTypeObject *type, const char **prefix, const char **name, const char **filename, int *line) {
+	*prefix = NULL;
+	*filename = NULL;
+	*line = 0;
+
+	if (PyFrame_Check(o)) {
+		PyFrameObject *frame = (PyFrameObject *) o;
+		PyCodeObject *code = frame->f_code;
+		PyObject *module = NULL;
+
+		if (frame->f_globals) {
+			module = PyDict_GetItemString(frame->f_globals, "__name__");
+		}
+		if (module && PyString_Check(module)) {
+			*prefix = PyString_AsString(module);
+		}
+
+		*name = PyString_AsString(code->co_name);
+		*filename = PyString_AsString(code->co_filename);
+		*line = code->co_firstlineno;
+	} else {
+		PyCFunctionObject *fn = (PyCFunctionObject *) o;
+
+		if (type) {
+			*prefix = type->tp_name;
+		} else if (fn->m_module && PyString_Check(fn->m_module)) {
+			*prefix = PyString_AsString(fn->m_module);
+		}
+
+		*name = fn->m_ml->ml_name;
+	}
+}
+
+*/
+import "C"
+
+import (
+	"runtime"
+	"runtime/cgo"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Profiler records the Python function calls made by the Threads which it
+// has been attached to.  Built-in functions are included.  The statistics of
+// all attached Threads are combined; use a Profiler per Thread to tell them
+// apart.
+//
+// A profiled Thread executes Python code more slowly.  The Profiler keeps
+// references to the code objects of the recorded functions.
+type Profiler struct {
+	lock      sync.Mutex
+	start     time.Time
+	functions map[profileKey]*profileFunction
+	order     []*profileFunction
+	roots     map[string]*profileNode
+}
+
+// FunctionProfile contains the statistics of a function.  Cumulative time
+// includes the time spent in the functions called by it (counted once for
+// recursive calls); Self time doesn't.  Go callbacks count as self time.
+type FunctionProfile struct {
+	Name       string // qualified with the module or the type of self
+	Filename   string // empty for built-in functions
+	Line       int    // first line of the function
+	Calls      int64
+	Cumulative time.Duration
+	Self       time.Duration
+}
+
+// profileKey identifies a Python code object or a built-in function (method
+// definition and the type of self).
+type profileKey struct {
+	key unsafe.Pointer
+	typ unsafe.Pointer
+}
+
+type profileFunction struct {
+	FunctionProfile
+}
+
+// profileNode is a node in the call tree.  A root node represents the Go
+// call stack which initiated the Python execution.
+type profileNode struct {
+	fn       *profileFunction
+	goStack  []uintptr
+	parent   *profileNode
+	children map[*profileFunction]*profileNode
+	calls    int64
+	self     time.Duration
+}
+
+func (n *profileNode) child(fn *profileFunction) *profileNode {
+	c := n.children[fn]
+	if c == nil {
+		c = &profileNode{
+			fn:       fn,
+			parent:   n,
+			children: make(map[*profileFunction]*profileNode),
+		}
+		n.children[fn] = c
+	}
+	return c
+}
+
+// threadProfile is the per-Thread state of a Profiler.  It is discarded when
+// the Profiler is detached, along with the calls which are in progress.
+type threadProfile struct {
+	profiler *Profiler
+	handle   cgo.Handle
+	goStack  []uintptr
+	stack    []profileCall
+	active   map[*profileFunction]int // recursion depth
+}
+
+type profileCall struct {
+	node  *profileNode
+	start time.Time
+	inner time.Duration
+}
+
+// NewProfiler creates a Profiler.  It must be attached to Threads with
+// SetProfiler.
+func NewProfiler() *Profiler {
+	return &Profiler{
+		start:     time.Now(),
+		functions: make(map[profileKey]*profileFunction),
+		roots:     make(map[string]*profileNode),
+	}
+}
+
+// SetProfiler starts recording the Python function calls made by the Thread.
+// A nil Profiler stops it.
+func (t *Thread) SetProfiler(p *Profiler) (err error) {
+	if t == nil {
+		t = defaultThread
+	}
+
+	var tp *threadProfile
+
+	if p != nil {
+		tp = &threadProfile{
+			profiler: p,
+			active:   make(map[*profileFunction]int),
+		}
+		tp.handle = cgo.NewHandle(tp)
+	}
+
+	t.execute(func() {
+		var handle C.uintptr_t
+		if tp != nil {
+			handle = C.uintptr_t(tp.handle)
+		}
+
+		if C.setProfile(handle) < 0 {
+			err = getError()
+			return
+		}
+
+		if old := t.profile.Swap(tp); old != nil {
+			old.handle.Delete()
+		}
+	})
+
+	if err != nil && tp != nil {
+		tp.handle.Delete()
+	}
+	return
+}
+
+// profileGoStack is called by Thread.execute before the function is queued.
+func (t *Thread) profileGoStack() []uintptr {
+	if t.profile.Load() == nil {
+		return nil
+	}
+
+	pcs := make([]uintptr, 64)
+	return pcs[:runtime.Callers(3, pcs)]
+}
+
+// setGoStack is called on the Thread before the function is executed.  The
+// stack is used as the root of subsequent Python calls.
+func (tp *threadProfile) setGoStack(pcs []uintptr) {
+	if len(tp.stack) == 0 {
+		tp.goStack = pcs
+	}
+}
+
+func (tp *threadProfile) enter(key, typ unsafe.Pointer, pyObject *C.PyObject) {
+	now := time.Now()
+
+	p := tp.profiler
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fn := p.functions[profileKey{key, typ}]
+	if fn == nil {
+		fn = p.newFunction(key, typ, pyObject)
+	}
+
+	var parent *profileNode
+
+	if n := len(tp.stack); n > 0 {
+		parent = tp.stack[n-1].node
+	} else {
+		parent = p.root(tp.goStack)
+	}
+
+	tp.active[fn]++
+	tp.stack = append(tp.stack, profileCall{node: parent.child(fn), start: now})
+}
+
+func (tp *threadProfile) leave() {
+	now := time.Now()
+
+	p := tp.profiler
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	n := len(tp.stack)
+	if n == 0 {
+		return // Called before profiling started.
+	}
+
+	call := tp.stack[n-1]
+	tp.stack = tp.stack[:n-1]
+
+	elapsed := now.Sub(call.start)
+	self := elapsed - call.inner
+
+	node := call.node
+	node.calls++
+	node.self += self
+
+	fn := node.fn
+	fn.Calls++
+	fn.Self += self
+	if depth := tp.active[fn] - 1; depth > 0 {
+		tp.active[fn] = depth
+	} else {
+		delete(tp.active, fn)
+		fn.Cumulative += elapsed
+	}
+
+	if n > 1 {
+		tp.stack[n-2].inner += elapsed
+	}
+}
+
+// newFunction is called with the GIL and the lock held.
+func (p *Profiler) newFunction(key, typ unsafe.Pointer, pyObject *C.PyObject) (fn *profileFunction) {
+	var (
+		prefix   *C.char
+		name     *C.char
+		filename *C.char
+		line     C.int
+	)
+
+	C.describeFunction(pyObject, (*C.PyTypeObject)(typ), &prefix, &name, &filename, &line)
+
+	fn = new(profileFunction)
+
+	fn.Name = C.GoString(name)
+	if prefix != nil {
+		fn.Name = C.GoString(prefix) + "." + fn.Name
+	}
+	if filename != nil {
+		fn.Filename = C.GoString(filename)
+	}
+	fn.Line = int(line)
+
+	// Keep the key from being reused by another function.
+	if typ != nil {
+		C.Py_IncRef((*C.PyObject)(typ))
+	} else if filename != nil {
+		C.Py_IncRef((*C.PyObject)(key))
+	}
+
+	p.functions[profileKey{key, typ}] = fn
+	p.order = append(p.order, fn)
+	return
+}
+
+func (p *Profiler) root(goStack []uintptr) *profileNode {
+	key := string(unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(goStack))), len(goStack)*int(unsafe.Sizeof(uintptr(0)))))
+
+	n := p.roots[key]
+	if n == nil {
+		n = &profileNode{
+			goStack:  goStack,
+			children: make(map[*profileFunction]*profileNode),
+		}
+		p.roots[key] = n
+	}
+	return n
+}
+
+// Functions gets the statistics of the functions which have been called so
+// far, in descending order of cumulative time.  Calls which are in progress
+// are not included.
+func (p *Profiler) Functions() (functions []FunctionProfile) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	functions = make([]FunctionProfile, len(p.order))
+	for i, fn := range p.order {
+		functions[i] = fn.FunctionProfile
+	}
+
+	sort.SliceStable(functions, func(i, j int) bool {
+		return functions[i].Cumulative > functions[j].Cumulative
+	})
+	return
+}
@@ -0,0 +1,779 @@
+package python
+
+/*
+
+#include <Python.h>
+
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+
+extern void goRelease(uintptr_t handle);
+extern void *goRepr(uintptr_t handle);
+extern void *goProxyGetAttr(uintptr_t handle, void *name);
+extern int goProxySetAttr(uintptr_t handle, void *name, void *value);
+extern ssize_t goProxyLength(uintptr_t handle);
+extern void *goProxyGetItem(uintptr_t handle, void *key);
+extern int goProxySetItem(uintptr_t handle, void *key, void *value);
+extern void *goProxyIter(uintptr_t handle);
+extern void *goFunctionCall(uintptr_t handle, void *args, void *kwargs);
+
+enum {
+	RUNTIME_ERROR,
+	ATTRIBUTE_ERROR,
+	INDEX_ERROR,
+	KEY_ERROR,
+	TYPE_ERROR,
+	VALUE_ERROR,
+	IO_ERROR,
+	EOF_ERROR,
+	NOT_IMPLEMENTED_ERROR,
+	STOP_ITERATION,
+};
+
+static void raise(int kind, const char *msg) {
+	PyObject *type;
+
+	switch (kind) {
+	case ATTRIBUTE_ERROR:       type = PyExc_AttributeError; break;
+	case INDEX_ERROR:           type = PyExc_IndexError; break;
+	case KEY_ERROR:             type = PyExc_KeyError; break;
+	case TYPE_ERROR:            type = PyExc_TypeError; break;
+	case VALUE_ERROR:           type = PyExc_ValueError; break;
+	case IO_ERROR:              type = PyExc_IOError; break;
+	case EOF_ERROR:             type = PyExc_EOFError; break;
+	case NOT_IMPLEMENTED_ERROR: type = PyExc_NotImplementedError; break;
+	case STOP_ITERATION:        type = PyExc_StopIteration; break;
+	default:                    type = PyExc_RuntimeError; break;
+	}
+
+	PyErr_SetString(type, msg);
+}
+
+static void reraise(PyObject *excInfo) {
+	PyObject *type, *value = Py_None, *trace = Py_None;
+
+	if (!PyArg_UnpackTuple(excInfo, "exc_info", 1, 3, &type, &value, &trace))
+		return;
+
+	if (trace == Py_None)
+		trace = NULL;
+
+	Py_INCREF(type);
+	Py_INCREF(value);
+	Py_XINCREF(trace);
+	PyErr_Restore(type, value, trace);
+}
+
+// GoObject refers to a Go value via a handle.
+typedef struct {
+	PyObject_HEAD
+	uintptr_t handle;
+} GoObject;
+
+static void GoObject_dealloc(PyObject *o) {
+	goRelease(((GoObject *) o)->handle);
+	PyObject_Del(o);
+}
+
+static PyObject *GoObject_repr(PyObject *o) {
+	return goRepr(((GoObject *) o)->handle);
+}
+
+static int isSpecialName(PyObject *name) {
+	return PyString_Check(name) && strncmp(PyString_AS_STRING(name), "__", 2) == 0;
+}
+
+static PyObject *GoProxy_getattro(PyObject *o, PyObject *name) {
+	if (isSpecialName(name)) {
+		return PyObject_GenericGetAttr(o, name);
+	}
+	return goProxyGetAttr(((GoObject *) o)->handle, name);
+}
+
+static int GoProxy_setattro(PyObject *o, PyObject *name, PyObject *value) {
+	if (isSpecialName(name)) {
+		return PyObject_GenericSetAttr(o, name, value);
+	}
+	return goProxySetAttr(((GoObject *) o)->handle, name, value);
+}
+
+static Py_ssize_t GoProxy_length(PyObject *o) {
+	return goProxyLength(((GoObject *) o)->handle);
+}
+
+static PyObject *GoProxy_subscript(PyObject *o, PyObject *key) {
+	return goProxyGetItem(((GoObject *) o)->handle, key);
+}
+
+static int GoProxy_ass_subscript(PyObject *o, PyObject *key, PyObject *value) {
+	return goProxySetItem(((GoObject *) o)->handle, key, value);
+}
+
+static PyObject *GoProxy_iter(PyObject *o) {
+	return goProxyIter(((GoObject *) o)->handle);
+}
+
+static PyObject *GoFunction_call(PyObject *o, PyObject *args, PyObject *kwargs) {
+	return goFunctionCall(((GoObject *) o)->handle, args, kwargs);
+}
+
+static PyMappingMethods GoProxy_as_mapping = {
+	GoProxy_length,
+	GoProxy_subscript,
+	GoProxy_ass_subscript,
+};
+
+static PyTypeObject GoProxyType = {
+	PyVarObject_HEAD_INIT(NULL, 0)
+	"go.proxy",
+	sizeof (GoObject),
+	0,
+	GoObject_dealloc,
+};
+
+static PyTypeObject GoFunctionType = {
+	PyVarObject_HEAD_INIT(NULL, 0)
+	"go.function",
+	sizeof (GoObject),
+	0,
+	GoObject_dealloc,
+};
+
+static int initProxyTypes(void) {
+	GoProxyType.tp_repr = GoObject_repr;
+	GoProxyType.tp_as_mapping = &GoProxy_as_mapping;
+	GoProxyType.tp_getattro = GoProxy_getattro;
+	GoProxyType.tp_setattro = GoProxy_setattro;
+	GoProxyType.tp_iter = GoProxy_iter;
+	GoProxyType.tp_flags = Py_TPFLAGS_DEFAULT;
+
+	if (PyType_Ready(&GoProxyType) < 0) {
+		return -1;
+	}
+
+	GoFunctionType.tp_repr = GoObject_repr;
+	GoFunctionType.tp_call = GoFunction_call;
+	GoFunctionType.tp_flags = Py_TPFLAGS_DEFAULT;
+
+	return PyType_Ready(&GoFunctionType);
+}
+
+static PyObject *GoObject_New(PyTypeObject *type, uintptr_t handle) {
+	GoObject *o = PyObject_New(GoObject, type);
+	if (o) {
+		o->handle = handle;
+	}
+	return (PyObject *) o;
+}
+
+static PyObject *GoProxy_New(uintptr_t handle) {
+	return GoObject_New(&GoProxyType, handle);
+}
+
+static PyObject *GoFunction_New(uintptr_t handle) {
+	return GoObject_New(&GoFunctionType, handle);
+}
+
+static uintptr_t GoProxy_Handle(PyObject *o) {
+	if (Py_TYPE(o) == &GoProxyType) {
+		return ((GoObject *) o)->handle;
+	}
+	return 0;
+}
+
+*/
+import "C"
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"runtime"
+	"runtime/cgo"
+	"unsafe"
+)
+
+func initProxy() {
+	if C.initProxyTypes() < 0 {
+		panic(getError())
+	}
+}
+
+// Proxied is translated to a Python object which refers to the wrapped Go
+// value instead of copying it.  See Proxy.
+type Proxied struct {
+	Value interface{}
+}
+
+// Proxy wraps a Go value so that Python code can manipulate it in place.  The
+// value should be a pointer (to a struct, slice or array), a map or a slice.
+//
+// Python attribute access reads and writes exported struct fields, and calls
+// exported methods.  Python names are matched with Go names like struct
+// fields are matched by Object.Unmarshal.  len(), item access and iteration
+// work with slices, arrays and maps.
+//
+// Nested structs, slices and maps are proxied in turn; other values are
+// translated by value.  Methods and functions whose first parameter is a
+// *Thread get the Thread which can be used to call Python.  A non-nil error
+// returned as the last result is raised as a Python exception.
+//
+// A function is translated to a callable object.
+//
+// Decoding a proxy yields the original Go value.
+func Proxy(v interface{}) Proxied {
+	return Proxied{v}
+}
+
+// proxy is referenced by a go.proxy object.
+type proxy struct {
+	v reflect.Value
+}
+
+// function is referenced by a go.function object.
+type function struct {
+	name string
+	f    reflect.Value
+}
+
+func newProxy(v reflect.Value) (pyProxy *C.PyObject, err error) {
+	handle := cgo.NewHandle(&proxy{v})
+
+	if pyProxy = C.GoProxy_New(C.uintptr_t(handle)); pyProxy == nil {
+		handle.Delete()
+		err = getError()
+	}
+	return
+}
+
+// callable is referenced by a go.function or a go.method object.
+type callable interface {
+	call(pyArgs, pyKwargs *C.PyObject) (*C.PyObject, error)
+}
+
+func newFunction(name string, f reflect.Value) (*C.PyObject, error) {
+	return newFunctionObject(&function{name, f})
+}
+
+func newFunctionObject(x callable) (pyFunction *C.PyObject, err error) {
+	handle := cgo.NewHandle(x)
+
+	if pyFunction = C.GoFunction_New(C.uintptr_t(handle)); pyFunction == nil {
+		handle.Delete()
+		err = getError()
+	}
+	return
+}
+
+// decodeProxy gets the Go value of a proxy or an instance of a class defined in
+// Go.  The result is false if the object is neither.
+func decodeProxy(pyValue *C.PyObject) (v reflect.Value, ok bool) {
+	if handle := C.GoProxy_Handle(pyValue); handle != 0 {
+		v = cgo.Handle(handle).Value().(*proxy).v
+		ok = true
+		return
+	}
+
+	return decodeInstance(pyValue)
+}
+
+// exception is raised as a specific Python exception type when returned by a
+// callback.
+type exception struct {
+	kind C.int
+	msg  string
+}
+
+func (e *exception) Error() string {
+	return e.msg
+}
+
+func attributeError(format string, args ...interface{}) error {
+	return &exception{C.ATTRIBUTE_ERROR, fmt.Sprintf(format, args...)}
+}
+
+func indexError(format string, args ...interface{}) error {
+	return &exception{C.INDEX_ERROR, fmt.Sprintf(format, args...)}
+}
+
+func keyError(format string, args ...interface{}) error {
+	return &exception{C.KEY_ERROR, fmt.Sprintf(format, args...)}
+}
+
+func typeError(format string, args ...interface{}) error {
+	return &exception{C.TYPE_ERROR, fmt.Sprintf(format, args...)}
+}
+
+func valueError(format string, args ...interface{}) error {
+	return &exception{C.VALUE_ERROR, fmt.Sprintf(format, args...)}
+}
+
+func ioError(format string, args ...interface{}) error {
+	return &exception{C.IO_ERROR, fmt.Sprintf(format, args...)}
+}
+
+var stopIteration = &exception{C.STOP_ITERATION, ""}
+
+// Reraise returns an error which raises the exception described by an
+// exc_info tuple (type, value, traceback) when returned by a callback, keeping
+// the original exception and traceback.
+func Reraise(excInfo Object) error {
+	return &reraised{excInfo}
+}
+
+type reraised struct {
+	excInfo Object
+}
+
+func (e *reraised) Error() string {
+	return "Python exception re-raised from exc_info"
+}
+
+// raise sets the Python exception state.
+func raise(err error) {
+	if e, ok := err.(*reraised); ok {
+		if o, ok := e.excInfo.(*object); ok {
+			C.reraise(o.pyObject)
+			runtime.KeepAlive(o)
+			return
+		}
+	}
+
+	kind := C.int(C.RUNTIME_ERROR)
+	if e, ok := err.(*exception); ok {
+		kind = e.kind
+	}
+
+	cMsg := C.CString(err.Error())
+	defer C.free(unsafe.Pointer(cMsg))
+
+	C.raise(kind, cMsg)
+}
+
+// raisePanic sets the Python exception state after a Go panic.
+func raisePanic(p interface{}) {
+	raise(fmt.Errorf("Go panic: %v", p))
+}
+
+// catch runs f on behalf of Python code, and sets the Python exception state
+// if it returns an error or panics.
+func catch(f func() error) (ok bool) {
+	defer func() {
+		if p := recover(); p != nil {
+			raisePanic(p)
+			ok = false
+		}
+	}()
+
+	if err := f(); err != nil {
+		raise(err)
+		return false
+	}
+
+	return true
+}
+
+// pyObject converts a pointer received from C.
+func pyObject(p unsafe.Pointer) *C.PyObject {
+	return (*C.PyObject)(p)
+}
+
+// pointer converts a result to be returned to C.
+func pointer(pyObject *C.PyObject, err error) (unsafe.Pointer, error) {
+	return unsafe.Pointer(pyObject), err
+}
+
+// attrName decodes an attribute name.
+func attrName(pyName *C.PyObject) (name string, err error) {
+	x, err := decode(pyName)
+	if err != nil {
+		return
+	}
+
+	name, ok := x.(string)
+	if !ok {
+		err = typeError("attribute name must be string")
+	}
+	return
+}
+
+func releaseHandle(handle cgo.Handle) {
+	handle.Delete()
+}
+
+func handleRepr(handle cgo.Handle) (pyRepr *C.PyObject) {
+	var s string
+
+	switch x := handle.Value().(type) {
+	case *proxy:
+		s = fmt.Sprintf("<go.proxy %s>", x.v.Type())
+
+	case *function:
+		s = fmt.Sprintf("<go.function %s>", x.name)
+
+	case *accessor:
+		s = fmt.Sprintf("<go.function %s>", x.name)
+	}
+
+	return encodeString(s)
+}
+
+// target dereferences pointers.
+func (p *proxy) target() reflect.Value {
+	v := p.v
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+func (p *proxy) getAttr(name string) (pyValue *C.PyObject, err error) {
+	if m, found := lookupMethod(p.v, name); found {
+		return newFunction(name, m)
+	}
+
+	if v := p.target(); v.Kind() == reflect.Struct {
+		if i, found := structFields(v.Type()).lookup(name); found {
+			return proxyOrEncode(v.Field(i))
+		}
+	}
+
+	err = attributeError("%s has no attribute '%s'", p.v.Type(), name)
+	return
+}
+
+func (p *proxy) setAttr(name string, pyValue *C.PyObject) (err error) {
+	if v := p.target(); v.Kind() == reflect.Struct && v.CanSet() {
+		if i, found := structFields(v.Type()).lookup(name); found {
+			if pyValue == nil {
+				return attributeError("cannot delete attribute '%s' of %s", name, p.v.Type())
+			}
+			return decodeInto(pyValue, v.Field(i))
+		}
+	}
+
+	err = attributeError("%s has no settable attribute '%s'", p.v.Type(), name)
+	return
+}
+
+func (p *proxy) length() (n int, err error) {
+	switch v := p.target(); v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.String:
+		n = v.Len()
+
+	default:
+		err = typeError("%s has no len()", p.v.Type())
+	}
+	return
+}
+
+func (p *proxy) getItem(pyKey *C.PyObject) (pyValue *C.PyObject, err error) {
+	switch v := p.target(); v.Kind() {
+	case reflect.Slice, reflect.Array:
+		var i int
+
+		if i, err = p.index(v, pyKey); err != nil {
+			return
+		}
+		return proxyOrEncode(v.Index(i))
+
+	case reflect.Map:
+		key := reflect.New(v.Type().Key()).Elem()
+
+		if err = decodeInto(pyKey, key); err != nil {
+			err = keyError("%v", err)
+			return
+		}
+
+		elem := v.MapIndex(key)
+		if !elem.IsValid() {
+			err = keyError("%v", key.Interface())
+			return
+		}
+		return proxyOrEncode(elem)
+
+	default:
+		err = typeError("%s is not subscriptable", p.v.Type())
+		return
+	}
+}
+
+func (p *proxy) setItem(pyKey, pyValue *C.PyObject) (err error) {
+	switch v := p.target(); v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if pyValue == nil {
+			return typeError("cannot delete items of %s", p.v.Type())
+		}
+
+		var i int
+
+		if i, err = p.index(v, pyKey); err != nil {
+			return
+		}
+
+		elem := v.Index(i)
+		if !elem.CanSet() {
+			return typeError("%s is not assignable", p.v.Type())
+		}
+
+		return decodeInto(pyValue, elem)
+
+	case reflect.Map:
+		key := reflect.New(v.Type().Key()).Elem()
+
+		if err = decodeInto(pyKey, key); err != nil {
+			return keyError("%v", err)
+		}
+
+		if pyValue == nil {
+			if !v.MapIndex(key).IsValid() {
+				return keyError("%v", key.Interface())
+			}
+			v.SetMapIndex(key, reflect.Value{})
+			return
+		}
+
+		elem := reflect.New(v.Type().Elem()).Elem()
+
+		if err = decodeInto(pyValue, elem); err != nil {
+			return
+		}
+
+		v.SetMapIndex(key, elem)
+		return
+
+	default:
+		return typeError("%s does not support item assignment", p.v.Type())
+	}
+}
+
+func (p *proxy) index(v reflect.Value, pyKey *C.PyObject) (i int, err error) {
+	if err = decodeInto(pyKey, reflect.ValueOf(&i).Elem()); err != nil {
+		err = typeError("%s indices must be integers", p.v.Type())
+		return
+	}
+
+	if i < 0 {
+		i += v.Len()
+	}
+	if i < 0 || i >= v.Len() {
+		err = indexError("%s index out of range", p.v.Type())
+	}
+	return
+}
+
+// iter creates an iterator over a snapshot of the items (or map keys).
+func (p *proxy) iter() (pyIter *C.PyObject, err error) {
+	var items []interface{}
+
+	switch v := p.target(); v.Kind() {
+	case reflect.Slice, reflect.Array:
+		items = make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = proxiedOrValue(v.Index(i))
+		}
+
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			items = append(items, key.Interface())
+		}
+
+	default:
+		err = typeError("%s is not iterable", p.v.Type())
+		return
+	}
+
+	pyList, err := encodeList(items)
+	if err != nil {
+		return
+	}
+	defer C.Py_DecRef(pyList)
+
+	if pyIter = C.PyObject_GetIter(pyList); pyIter == nil {
+		err = getError()
+	}
+	return
+}
+
+// lookupMethod finds an exported method of a value (or its pointer, if
+// addressable).
+func lookupMethod(v reflect.Value, name string) (m reflect.Value, found bool) {
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		v = v.Addr()
+	}
+
+	normalized := normalizeName(name)
+	t := v.Type()
+
+	for i := 0; i < t.NumMethod(); i++ {
+		if normalizeName(t.Method(i).Name) == normalized {
+			m = v.Method(i)
+			found = true
+			return
+		}
+	}
+	return
+}
+
+var (
+	bigIntType    = reflect.TypeOf(big.Int{})
+	objectType    = reflect.TypeOf((*Object)(nil)).Elem()
+	listType      = reflect.TypeOf(List{})
+	tupleType     = reflect.TypeOf(Tuple{})
+	setType       = reflect.TypeOf(Set{})
+	frozenSetType = reflect.TypeOf(FrozenSet{})
+)
+
+// byValue reports whether a type is translated by value even though it could
+// be proxied.
+func byValue(t reflect.Type) bool {
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) || t.Implements(objectType) {
+		return true
+	}
+
+	switch t {
+	case timeType, dateType, timeOfDayType, bigIntType, reflect.PtrTo(bigIntType), listType, tupleType, setType, frozenSetType:
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+
+	case reflect.Struct, reflect.Map, reflect.Array:
+		return false
+
+	case reflect.Ptr:
+		return byValue(t.Elem())
+	}
+
+	return true
+}
+
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+// proxiedOrValue wraps a nested value in Proxied if appropriate.
+func proxiedOrValue(v reflect.Value) interface{} {
+	if !byValue(v.Type()) && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		if v.CanAddr() && v.Kind() != reflect.Map && v.Kind() != reflect.Ptr {
+			v = v.Addr()
+		}
+		return Proxied{v.Interface()}
+	}
+	return v.Interface()
+}
+
+// proxyOrEncode translates a nested value.
+func proxyOrEncode(v reflect.Value) (*C.PyObject, error) {
+	return encode(proxiedOrValue(v))
+}
+
+// call a Go function with Python arguments.
+func (f *function) call(pyArgs, pyKwargs *C.PyObject) (pyResult *C.PyObject, err error) {
+	if pyKwargs != nil && C.PyDict_Size(pyKwargs) > 0 {
+		err = typeError("%s does not accept keyword arguments", f.name)
+		return
+	}
+
+	t := f.f.Type()
+	numIn := t.NumIn()
+	passThread := numIn > 0 && t.In(0) == threadType
+
+	first := 0
+	if passThread {
+		first = 1
+	}
+
+	numArgs := int(C.PyTuple_Size(pyArgs))
+	numParams := numIn - first
+
+	if t.IsVariadic() {
+		if numArgs < numParams-1 {
+			err = typeError("%s takes at least %d arguments (%d given)", f.name, numParams-1, numArgs)
+			return
+		}
+	} else if numArgs != numParams {
+		err = typeError("%s takes %d arguments (%d given)", f.name, numParams, numArgs)
+		return
+	}
+
+	in := make([]reflect.Value, first+numArgs)
+
+	for i := 0; i < numArgs; i++ {
+		var paramType reflect.Type
+
+		if j := first + i; t.IsVariadic() && j >= numIn-1 {
+			paramType = t.In(numIn - 1).Elem()
+		} else {
+			paramType = t.In(j)
+		}
+
+		arg := reflect.New(paramType).Elem()
+
+		if err = decodeInto(C.PyTuple_GetItem(pyArgs, C.Py_ssize_t(i)), arg); err != nil {
+			err = typeError("%s argument %d: %v", f.name, i+1, err)
+			return
+		}
+
+		in[first+i] = arg
+	}
+
+	var out []reflect.Value
+
+	if p := callGo(func(thread *Thread) {
+		if passThread {
+			in[0] = reflect.ValueOf(thread)
+		}
+		out = f.f.Call(in)
+	}); p != nil {
+		raisePanic(p)
+		return
+	}
+
+	if n := len(out); n > 0 && t.Out(n-1) == errorType {
+		if e := out[n-1].Interface(); e != nil {
+			err = e.(error)
+			return
+		}
+		out = out[:n-1]
+	}
+
+	switch len(out) {
+	case 0:
+		return encode(nil)
+
+	case 1:
+		return proxyOrEncode(out[0])
+
+	default:
+		results := make([]interface{}, len(out))
+		for i, v := range out {
+			results[i] = proxiedOrValue(v)
+		}
+		return encodeTuple(results)
+	}
+}
+
+var (
+	threadType = reflect.TypeOf((*Thread)(nil))
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// encodeProxied translates a Proxied value.
+func encodeProxied(p Proxied) (*C.PyObject, error) {
+	v := reflect.ValueOf(p.Value)
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return encode(nil)
+	}
+
+	if v.Kind() == reflect.Func {
+		return newFunction(v.Type().String(), v)
+	}
+
+	if pyInstance, ok, err := newInstance(v); ok {
+		return pyInstance, err
+	}
+
+	return newProxy(v)
+}
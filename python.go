@@ -48,6 +48,22 @@ static PyObject *Long_FromUint64(uint64_t v) {
 	return PyLong_FromUnsignedLongLong(v);
 }
 
+static PyObject *Long_FromBigEndian(const unsigned char *b, size_t n) {
+	return _PyLong_FromByteArray(b, n, 0, 0);
+}
+
+static int Long_AsBigEndian(PyObject *o, unsigned char *b, size_t n) {
+	return _PyLong_AsByteArray((PyLongObject *) o, b, n, 0, 0);
+}
+
+static PyObject *Unicode_FromUTF8(const char *s, Py_ssize_t size) {
+	return PyUnicode_DecodeUTF8(s, size, "strict");
+}
+
+static PyObject *Unicode_AsUTF8String(PyObject *o) {
+	return PyUnicode_AsUTF8String(o);
+}
+
 static int getType(PyObject *o) {
 	if (o == Py_None) {
 		return 1;
@@ -73,6 +89,24 @@ static int getType(PyObject *o) {
 	if (PyComplex_Check(o)) {
 		return 8;
 	}
+	if (PyUnicode_Check(o)) {
+		return 11;
+	}
+	if (PyByteArray_Check(o)) {
+		return 12;
+	}
+	if (PySet_Check(o)) {
+		return 13;
+	}
+	if (PyFrozenSet_Check(o)) {
+		return 14;
+	}
+	if (PyTuple_Check(o)) {
+		return 15;
+	}
+	if (PyList_Check(o)) {
+		return 16;
+	}
 	if (PySequence_Check(o)) {
 		return 9;
 	}
@@ -86,6 +120,10 @@ static PyObject *Mapping_Items(PyObject *o) {
 	return PyMapping_Items(o);
 }
 
+static int Pair_Unpack(PyObject *o, PyObject **key, PyObject **value) {
+	return PyArg_UnpackTuple(o, "item", 2, 2, key, value);
+}
+
 static PyObject *Object_CallObjectStealingArgs(PyObject *o, PyObject *args, int *resultType) {
 	PyObject *result = PyObject_CallObject(o, args);
 	Py_DECREF(args);
@@ -104,18 +142,66 @@ static PyObject *Object_CallObjectStealingArgs(PyObject *o, PyObject *args, int
 import "C"
 
 import (
+	"context"
 	"fmt"
+	"math/big"
+	"reflect"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
+
+	"github.com/tsavola/go-python/internal/types"
 )
 
+// UnicodeStrings makes the string type be translated to Python's unicode type
+// instead of str.  It should be set before Python is called.
+var UnicodeStrings bool
+
+// Bytes is translated to Python's str type even if UnicodeStrings is set.
+type Bytes = types.Bytes
+
+// Unicode is translated to Python's unicode type even if UnicodeStrings is not
+// set.
+type Unicode = types.Unicode
+
+// TypedSequences makes Python's tuple and list types be translated to Tuple and
+// List instead of []interface{}.  It should be set before Python is called.
+var TypedSequences bool
+
+// ListSlices makes the []interface{} type be translated to Python's list type
+// instead of tuple.  It should be set before Python is called.
+var ListSlices bool
+
+// List is translated to Python's list type even if ListSlices is not set.
+type List = types.List
+
+// Tuple is translated to Python's tuple type even if ListSlices is set.
+type Tuple = types.Tuple
+
+// Set is translated to Python's set type.
+type Set = types.Set
+
+// FrozenSet is translated to Python's frozenset type.
+type FrozenSet = types.FrozenSet
+
+// StructObjects makes Go structs be translated to instances of namedtuple
+// classes (generated for each struct type) instead of dicts.  It should be set
+// before Python is called.
+var StructObjects bool
+
+// ByteArray is translated to Python's bytearray type.  ([]byte is translated
+// to str.)
+type ByteArray = types.ByteArray
+
 var (
 	defaultThread *Thread
 
 	initLock     sync.Mutex
 	initialized  bool
 	pyEmptyTuple *C.PyObject
+	pyZero       *C.PyObject
 	falseObject  *object
 	trueObject   *object
 )
@@ -134,8 +220,13 @@ func threadInit() (defaultThreadState *C.PyThreadState) {
 		C.PySys_SetArgvEx(0, nil, 0)
 
 		pyEmptyTuple = C.PyTuple_New(0)
-		falseObject = &object{C.False_INCREF()}
-		trueObject = &object{C.True_INCREF()}
+		pyZero = C.PyInt_FromLong(0)
+		falseObject = &object{pyObject: C.False_INCREF()}
+		trueObject = &object{pyObject: C.True_INCREF()}
+
+		initBuffer()
+		initProxy()
+		initClass()
 
 		defaultThreadState = C.PyEval_SaveThread()
 
@@ -147,7 +238,10 @@ func threadInit() (defaultThreadState *C.PyThreadState) {
 
 // Thread for Python evaluation.
 type Thread struct {
-	queue chan func()
+	queue   chan func()
+	outputs [2]redirection
+	profile atomic.Pointer[threadProfile]
+	metrics threadMetrics
 }
 
 // NewThread creates an alternative thread to be passed to the Import function
@@ -177,6 +271,9 @@ func (t *Thread) loop() {
 		C.PyGILState_Release(gilState)
 	}
 
+	threads.Store(threadState, t)
+	defer threads.Delete(threadState)
+
 	for f := range t.queue {
 		C.PyEval_RestoreThread(threadState)
 		f()
@@ -187,6 +284,10 @@ func (t *Thread) loop() {
 	C.PyThreadState_Clear(threadState)
 	C.PyThreadState_Delete(threadState)
 	C.PyGILState_Release(gilState)
+
+	if tp := t.profile.Swap(nil); tp != nil {
+		tp.handle.Delete()
+	}
 }
 
 // execute Python code.
@@ -196,9 +297,18 @@ func (t *Thread) execute(f func()) {
 	}
 
 	c := make(chan interface{}, 1)
+	goStack := t.profileGoStack()
+	queued := time.Now()
 
 	t.queue <- func() {
-		defer func() { c <- recover() }()
+		start := time.Now()
+		defer func() {
+			t.metrics.executed(queued, start)
+			c <- recover()
+		}()
+		if tp := t.profile.Load(); tp != nil {
+			tp.setGoStack(goStack)
+		}
 		f()
 	}
 
@@ -245,9 +355,47 @@ type Object interface {
 	// Value translates a Python object to a Go type (if possible).
 	Value(t *Thread) (interface{}, error)
 
+	// ValueJSON combines Value method and JSONValue function.
+	ValueJSON(t *Thread) (interface{}, error)
+
+	// MarshalJSON implements json.Marshaler.  Python containers are
+	// serialized directly; other objects are translated to Go values which
+	// are marshaled as if converted with JSONValue.  Object keys are sorted.
+	// Always uses the default thread.
+	MarshalJSON() ([]byte, error)
+
+	// Unmarshal translates a Python object to a Go value pointed to by v.
+	// Nested values are translated to the types of the pointed-to value,
+	// using the Unmarshaler interface when implemented.
+	Unmarshal(t *Thread, v interface{}) error
+
+	// Buffer accesses the memory of an object which supports the buffer
+	// protocol.  The buffer must be released after use.
+	Buffer(t *Thread) (*Buffer, error)
+
+	// Chan iterates over an iterable object (such as a generator) in the
+	// background, and delivers the translated items via a channel.  The
+	// channel is closed after the last item, after which the error channel
+	// delivers nil or the error which ended the iteration.  Cancellation of
+	// the context ends the iteration early; a generator is closed in that
+	// case.
+	Chan(ctx context.Context, t *Thread) (<-chan interface{}, <-chan error)
+
+	// Repr gets the canonical string representation of an object.
+	Repr(t *Thread) (string, error)
+
+	// Str gets the informal string representation of an object.
+	Str(t *Thread) (string, error)
+
 	// String representation of an object.  Always uses the default thread.
 	// The result is an arbitrary value on error.
 	String() string
+
+	// Format implements fmt.Formatter.  The %v and %s verbs use Str, %#v
+	// uses Repr, and %q quotes the Str result.  Width, precision and flags
+	// apply to the resulting string.  Always uses the default thread.  Errors
+	// are written to the output in place of the value.
+	Format(f fmt.State, verb rune)
 }
 
 // object owns a single (Python) reference to the wrapped Python object until
@@ -255,6 +403,7 @@ type Object interface {
 // copied by value.
 type object struct {
 	pyObject *C.PyObject
+	metrics  *threadMetrics // of the Thread which created the object, or nil
 }
 
 // newObject wraps a Python object.
@@ -281,7 +430,13 @@ func newObjectType(pyType C.int, pyObject *C.PyObject) (o Object, err error) {
 		o = trueObject
 
 	default:
-		o = &object{pyObject}
+		var m *threadMetrics
+		if t := lookupThread(); t != nil {
+			m = &t.metrics
+			m.objects.Add(1)
+		}
+
+		o = &object{pyObject, m}
 		runtime.SetFinalizer(o, finalizeObject)
 	}
 
@@ -289,6 +444,10 @@ func newObjectType(pyType C.int, pyObject *C.PyObject) (o Object, err error) {
 }
 
 func finalizeObject(o *object) {
+	if o.metrics != nil {
+		o.metrics.objects.Add(-1)
+	}
+
 	defaultThread.execute(func() {
 		C.DECREF(o.pyObject)
 	})
@@ -296,13 +455,10 @@ func finalizeObject(o *object) {
 
 // Import a Python module.
 func Import(t *Thread, name string) (module Object, err error) {
-	cName := C.CString(name)
-	defer C.free(unsafe.Pointer(cName))
-
 	t.execute(func() {
-		pyModule := C.PyImport_ImportModule(cName)
-		if pyModule == nil {
-			err = getError()
+		var pyModule *C.PyObject
+
+		if pyModule, err = importModule(name); err != nil {
 			return
 		}
 		defer C.DECREF(pyModule)
@@ -312,6 +468,92 @@ func Import(t *Thread, name string) (module Object, err error) {
 	return
 }
 
+func importModule(name string) (pyModule *C.PyObject, err error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	if pyModule = C.PyImport_ImportModule(cName); pyModule == nil {
+		err = getError()
+	}
+	return
+}
+
+// defineClass runs Python source code and gets a class defined by it.
+func defineClass(source, name string) (pyClass *C.PyObject, err error) {
+	pyGlobals, err := encodeDict(map[interface{}]interface{}{"__name__": "go"})
+	if err != nil {
+		return
+	}
+	defer C.Py_DecRef(pyGlobals)
+
+	cBuiltins := C.CString("__builtins__")
+	defer C.free(unsafe.Pointer(cBuiltins))
+
+	if C.PyDict_SetItemString(pyGlobals, cBuiltins, C.PyEval_GetBuiltins()) < 0 {
+		err = getError()
+		return
+	}
+
+	cSource := C.CString(source)
+	defer C.free(unsafe.Pointer(cSource))
+
+	pyResult := C.PyRun_StringFlags(cSource, C.Py_file_input, pyGlobals, pyGlobals, nil)
+	if pyResult == nil {
+		err = getError()
+		return
+	}
+	C.Py_DecRef(pyResult)
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	if pyClass = C.PyDict_GetItemString(pyGlobals, cName); pyClass == nil {
+		err = attributeError("source did not define %s", name)
+		return
+	}
+
+	C.Py_IncRef(pyClass)
+	return
+}
+
+// lazyClass is defined on first use and kept forever.
+type lazyClass struct {
+	source string
+	name   string
+
+	lock    sync.Mutex
+	pyClass *C.PyObject
+}
+
+// get the class.  The lock isn't held while Python code runs, as it may
+// release the GIL; if threads race, the first definition is kept.
+func (c *lazyClass) get() (pyClass *C.PyObject, err error) {
+	c.lock.Lock()
+	pyClass = c.pyClass
+	c.lock.Unlock()
+
+	if pyClass != nil {
+		return
+	}
+
+	pyNewClass, err := defineClass(c.source, c.name)
+	if err != nil {
+		return
+	}
+
+	c.lock.Lock()
+	if pyClass = c.pyClass; pyClass == nil {
+		pyClass = pyNewClass
+		c.pyClass = pyClass
+	}
+	c.lock.Unlock()
+
+	if pyClass != pyNewClass {
+		C.Py_DecRef(pyNewClass)
+	}
+	return
+}
+
 func (o *object) Attr(t *Thread, name string) (attr Object, err error) {
 	t.execute(func() {
 		var pyAttr *C.PyObject
@@ -500,6 +742,20 @@ func (o *object) Value(t *Thread) (v interface{}, err error) {
 	return
 }
 
+func (o *object) Repr(t *Thread) (s string, err error) {
+	t.execute(func() {
+		s, err = repr(o.pyObject)
+	})
+	return
+}
+
+func (o *object) Str(t *Thread) (s string, err error) {
+	t.execute(func() {
+		s, err = str(o.pyObject)
+	})
+	return
+}
+
 func (o *object) String() (s string) {
 	defaultThread.execute(func() {
 		s = stringify(o.pyObject)
@@ -507,6 +763,41 @@ func (o *object) String() (s string) {
 	return
 }
 
+func (o *object) Format(f fmt.State, verb rune) {
+	var (
+		s   string
+		err error
+	)
+
+	switch verb {
+	case 'v':
+		if f.Flag('#') {
+			s, err = o.Repr(nil)
+		} else {
+			s, err = o.Str(nil)
+		}
+
+	case 's', 'q':
+		s, err = o.Str(nil)
+
+	default:
+		fmt.Fprintf(f, "%%!%c(python.Object=%s)", verb, o.String())
+		return
+	}
+
+	if err != nil {
+		fmt.Fprintf(f, "%%!%c(%v)", verb, err)
+		return
+	}
+
+	if verb == 'v' {
+		verb = 's'
+	}
+
+	// Apply width, precision and flags to the string.
+	fmt.Fprintf(f, fmt.FormatString(f, verb), s)
+}
+
 func getAttr(pyObject *C.PyObject, name string) (pyResult *C.PyObject, err error) {
 	cName := C.CString(name)
 	defer C.free(unsafe.Pointer(cName))
@@ -539,6 +830,49 @@ func call(pyObject *C.PyObject, name string, args []interface{}) (pyType C.int,
 	return invoke(pyMember, args)
 }
 
+// repr gets the canonical string representation of a Python object.
+func repr(pyObject *C.PyObject) (s string, err error) {
+	pyResult := C.PyObject_Repr(pyObject)
+	if pyResult == nil {
+		err = getError()
+		return
+	}
+	defer C.DECREF(pyResult)
+
+	return stringValue(pyResult)
+}
+
+// str gets the informal string representation of a Python object.
+func str(pyObject *C.PyObject) (s string, err error) {
+	pyResult := C.PyObject_Str(pyObject)
+	if pyResult == nil {
+		err = getError()
+		return
+	}
+	defer C.DECREF(pyResult)
+
+	return stringValue(pyResult)
+}
+
+// stringValue copies the contents of a Python string object.  It may contain
+// NUL bytes.
+func stringValue(pyString *C.PyObject) (s string, err error) {
+	var (
+		cString *C.char
+		size    C.Py_ssize_t
+	)
+
+	if C.PyString_AsStringAndSize(pyString, &cString, &size) < 0 {
+		err = getError()
+		return
+	}
+
+	s = C.GoStringN(cString, C.int(size))
+	return
+}
+
+// stringify is like str, but returns an arbitrary value on error.  The Python
+// exception state is cleared.
 func stringify(pyObject *C.PyObject) (s string) {
 	if pyResult := C.PyObject_Str(pyObject); pyResult != nil {
 		defer C.DECREF(pyResult)
@@ -600,7 +934,23 @@ func encode(x interface{}) (pyValue *C.PyObject, err error) {
 		pyValue = C.Long_FromInt64(C.int64_t(value))
 
 	case string:
-		pyValue = C.PyString_FromStringAndSize(C.CString(value), C.long(len(value)))
+		if UnicodeStrings {
+			pyValue = encodeUnicode(value)
+		} else {
+			pyValue = encodeString(value)
+		}
+
+	case Bytes:
+		pyValue = encodeString(string(value))
+
+	case Unicode:
+		pyValue = encodeUnicode(string(value))
+
+	case []byte:
+		pyValue = C.PyString_FromStringAndSize(bytesPointer(value), C.Py_ssize_t(len(value)))
+
+	case ByteArray:
+		pyValue = C.PyByteArray_FromStringAndSize(bytesPointer(value), C.Py_ssize_t(len(value)))
 
 	case uint:
 		pyValue = C.Long_FromUint64(C.uint64_t(value))
@@ -617,19 +967,72 @@ func encode(x interface{}) (pyValue *C.PyObject, err error) {
 	case uintptr:
 		pyValue = C.Long_FromUint64(C.uint64_t(value))
 
+	case time.Time:
+		return encodeDateTime(value)
+
+	case time.Duration:
+		return encodeTimedelta(value)
+
+	case Date:
+		return encodeDate(value)
+
+	case TimeOfDay:
+		return encodeTime(value)
+
+	case *big.Int:
+		if value == nil {
+			pyValue = C.None_INCREF()
+			return
+		}
+		return encodeBigInt(value)
+
+	case big.Int:
+		return encodeBigInt(&value)
+
 	case []interface{}:
-		return encodeTuple(value)
+		return encodeShared(reflect.ValueOf(value), func() (*C.PyObject, error) {
+			if ListSlices {
+				return encodeList(value)
+			}
+			return encodeTuple(value)
+		})
+
+	case List:
+		return encodeShared(reflect.ValueOf(value), func() (*C.PyObject, error) {
+			return encodeList(value)
+		})
+
+	case Tuple:
+		return encodeShared(reflect.ValueOf(value), func() (*C.PyObject, error) {
+			return encodeTuple(value)
+		})
+
+	case Set:
+		return encodeSet(C.PySet_New(nil), value)
+
+	case FrozenSet:
+		return encodeSet(C.PyFrozenSet_New(nil), value)
 
 	case map[interface{}]interface{}:
-		return encodeDict(value)
+		return encodeShared(reflect.ValueOf(value), func() (*C.PyObject, error) {
+			return encodeDict(value)
+		})
 
 	case *object:
 		pyValue = value.pyObject
 		C.INCREF(pyValue)
 
+	case Proxied:
+		return encodeProxied(value)
+
+	case FileObject:
+		return encodeFile(value.Value)
+
+	case Marshaler:
+		return encodeMarshaler(value)
+
 	default:
-		err = fmt.Errorf("unable to translate %t to Python", x)
-		return
+		return encodeReflect(reflect.ValueOf(x))
 	}
 
 	if pyValue == nil {
@@ -638,6 +1041,62 @@ func encode(x interface{}) (pyValue *C.PyObject, err error) {
 	return
 }
 
+// bytesPointer returns a pointer to the first byte, or nil if the slice is
+// empty.  The slice must not be modified by C code.
+func bytesPointer(b []byte) *C.char {
+	if len(b) == 0 {
+		return nil
+	}
+	return (*C.char)(unsafe.Pointer(&b[0]))
+}
+
+// stringPointer returns a pointer to the first byte, or nil if the string is
+// empty.  The string must not be modified by C code.
+func stringPointer(s string) *C.char {
+	if len(s) == 0 {
+		return nil
+	}
+	return (*C.char)(unsafe.Pointer(unsafe.StringData(s)))
+}
+
+// encodeString translates a Go string to a Python str object.  The contents
+// are copied directly from Go memory.
+func encodeString(s string) *C.PyObject {
+	return C.PyString_FromStringAndSize(stringPointer(s), C.Py_ssize_t(len(s)))
+}
+
+// encodeUnicode translates a UTF-8 string to a Python unicode object.  The
+// contents are decoded directly from Go memory.
+func encodeUnicode(s string) *C.PyObject {
+	return C.Unicode_FromUTF8(stringPointer(s), C.Py_ssize_t(len(s)))
+}
+
+// encodeBigInt translates an arbitrary-precision Go integer to a Python
+// object.
+func encodeBigInt(i *big.Int) (pyLong *C.PyObject, err error) {
+	b := i.Bytes()
+
+	var p *C.uchar
+	if len(b) > 0 {
+		p = (*C.uchar)(unsafe.Pointer(&b[0]))
+	}
+
+	if pyLong = C.Long_FromBigEndian(p, C.size_t(len(b))); pyLong == nil {
+		err = getError()
+		return
+	}
+
+	if i.Sign() < 0 {
+		pyMagnitude := pyLong
+		defer C.DECREF(pyMagnitude)
+
+		if pyLong = C.PyNumber_Negative(pyMagnitude); pyLong == nil {
+			err = getError()
+		}
+	}
+	return
+}
+
 // encodeTuple translates a Go array to a Python object.
 func encodeTuple(array []interface{}) (pyTuple *C.PyObject, err error) {
 	if len(array) == 0 {
@@ -671,6 +1130,77 @@ func encodeTuple(array []interface{}) (pyTuple *C.PyObject, err error) {
 	return
 }
 
+// encodeList translates a Go array to a Python object.
+func encodeList(array []interface{}) (pyList *C.PyObject, err error) {
+	pyList = C.PyList_New(C.Py_ssize_t(len(array)))
+	if pyList == nil {
+		err = getError()
+		return
+	}
+
+	var ok bool
+
+	defer func() {
+		if !ok {
+			C.DECREF(pyList)
+			pyList = nil
+		}
+	}()
+
+	for i, item := range array {
+		var pyItem *C.PyObject
+
+		if pyItem, err = encode(item); err != nil {
+			return
+		}
+
+		C.PyList_SetItem(pyList, C.Py_ssize_t(i), pyItem)
+	}
+
+	ok = true
+
+	return
+}
+
+// encodeSet translates a Go set to a new Python set or frozenset object.
+func encodeSet(pySet *C.PyObject, set map[interface{}]struct{}) (_ *C.PyObject, err error) {
+	if pySet == nil {
+		err = getError()
+		return
+	}
+
+	var ok bool
+
+	defer func() {
+		if !ok {
+			C.DECREF(pySet)
+		}
+	}()
+
+	for item := range set {
+		if err = encodeSetItem(pySet, item); err != nil {
+			return
+		}
+	}
+
+	ok = true
+
+	return pySet, nil
+}
+
+func encodeSetItem(pySet *C.PyObject, item interface{}) (err error) {
+	pyItem, err := encode(item)
+	if err != nil {
+		return
+	}
+	defer C.DECREF(pyItem)
+
+	if C.PySet_Add(pySet, pyItem) < 0 {
+		err = getError()
+	}
+	return
+}
+
 // encodeDict translates a Go map to a Python object.
 func encodeDict(m map[interface{}]interface{}) (pyDict *C.PyObject, err error) {
 	pyDict = C.PyDict_New()
@@ -714,6 +1244,11 @@ func encodeDictItem(pyDict *C.PyObject, key, value interface{}) (err error) {
 	return
 }
 
+// typeOf classifies a Python object.  It must be non-NULL.
+func typeOf(pyValue *C.PyObject) C.int {
+	return C.getType(pyValue)
+}
+
 // decode translates a Python object to a Go value.  It must be non-NULL.
 func decode(pyValue *C.PyObject) (interface{}, error) {
 	return decodeType(C.getType(pyValue), pyValue)
@@ -722,6 +1257,19 @@ func decode(pyValue *C.PyObject) (interface{}, error) {
 // decodeType translates a Python object to a Go value.  Its type must be
 // non-zero.
 func decodeType(pyType C.int, pyValue *C.PyObject) (value interface{}, err error) {
+	if pyType > 3 {
+		if v, ok := decodeProxy(pyValue); ok {
+			value = v.Interface()
+			return
+		}
+
+		var ok bool
+
+		if value, ok, err = decodeRegistered(pyValue); ok {
+			return
+		}
+	}
+
 	switch pyType {
 	case 0:
 		err = getError()
@@ -736,7 +1284,7 @@ func decodeType(pyType C.int, pyValue *C.PyObject) (value interface{}, err error
 		value = true
 
 	case 4:
-		value = C.GoString(C.PyString_AsString(pyValue))
+		return stringValue(pyValue)
 
 	case 5:
 		value = int(C.PyInt_AsLong(pyValue))
@@ -747,19 +1295,18 @@ func decodeType(pyType C.int, pyValue *C.PyObject) (value interface{}, err error
 
 		switch overflow {
 		case -1:
-			err = fmt.Errorf("Python integer %s is too small", stringify(pyValue))
+			return decodeBigInt(pyValue)
 
 		case 0:
 			value = i
 
 		case 1:
 			n := uint64(C.PyLong_AsUnsignedLongLong(pyValue))
-			if n == 0xffffffffffffffff {
+			if n == 0xffffffffffffffff && C.PyErr_Occurred() != nil {
 				C.PyErr_Clear()
-				err = fmt.Errorf("Python integer %s is too large", stringify(pyValue))
-			} else {
-				value = n
+				return decodeBigInt(pyValue)
 			}
+			value = n
 		}
 
 	case 7:
@@ -774,14 +1321,98 @@ func decodeType(pyType C.int, pyValue *C.PyObject) (value interface{}, err error
 	case 10:
 		return decodeMapping(pyValue)
 
+	case 11:
+		return decodeUnicode(pyValue)
+
+	case 12:
+		value = C.GoBytes(unsafe.Pointer(C.PyByteArray_AsString(pyValue)), C.int(C.PyByteArray_Size(pyValue)))
+
+	case 13:
+		var set map[interface{}]struct{}
+		set, err = decodeSet(pyValue)
+		value = Set(set)
+
+	case 14:
+		var set map[interface{}]struct{}
+		set, err = decodeSet(pyValue)
+		value = FrozenSet(set)
+
+	case 15:
+		var array []interface{}
+		if array, err = decodeSequence(pyValue); err == nil && TypedSequences {
+			value = Tuple(array)
+		} else {
+			value = array
+		}
+
+	case 16:
+		var array []interface{}
+		if array, err = decodeSequence(pyValue); err == nil && TypedSequences {
+			value = List(array)
+		} else {
+			value = array
+		}
+
 	default:
-		err = fmt.Errorf("unable to translate %s from Python", stringify(C.PyObject_Type(pyValue)))
+		var ok bool
+
+		if value, ok, err = decodeDateTimeType(pyValue); err == nil && !ok {
+			err = fmt.Errorf("unable to translate %s from Python", stringify(C.PyObject_Type(pyValue)))
+		}
+		return
+	}
+
+	return
+}
+
+// decodeBigInt translates a Python long object to an arbitrary-precision Go
+// integer.
+func decodeBigInt(pyLong *C.PyObject) (i *big.Int, err error) {
+	negative := C.PyObject_RichCompareBool(pyLong, pyZero, C.Py_LT)
+	if negative < 0 {
+		err = getError()
+		return
+	}
+
+	pyMagnitude := C.PyNumber_Absolute(pyLong)
+	if pyMagnitude == nil {
+		err = getError()
+		return
+	}
+	defer C.DECREF(pyMagnitude)
+
+	bits := C._PyLong_NumBits(pyMagnitude)
+	if bits == C.size_t(^uintptr(0)) {
+		err = getError()
+		return
+	}
+
+	b := make([]byte, bits/8+1)
+
+	if C.Long_AsBigEndian(pyMagnitude, (*C.uchar)(unsafe.Pointer(&b[0])), C.size_t(len(b))) < 0 {
+		err = getError()
 		return
 	}
 
+	i = new(big.Int).SetBytes(b)
+	if negative != 0 {
+		i.Neg(i)
+	}
 	return
 }
 
+// decodeUnicode translates a Python object to a UTF-8 string.
+func decodeUnicode(pyUnicode *C.PyObject) (s string, err error) {
+	pyString := C.Unicode_AsUTF8String(pyUnicode)
+	if pyString == nil {
+		err = getError()
+		return
+	}
+	defer C.DECREF(pyString)
+
+	return stringValue(pyString)
+}
+
 // decodeSequence translates a Python object to a Go array.
 func decodeSequence(pySequence *C.PyObject) (array []interface{}, err error) {
 	length := int(C.PySequence_Size(pySequence))
@@ -806,37 +1437,116 @@ func decodeSequence(pySequence *C.PyObject) (array []interface{}, err error) {
 	return
 }
 
+// decodeSet translates a Python set or frozenset object to a Go set.
+func decodeSet(pySet *C.PyObject) (set map[interface{}]struct{}, err error) {
+	pyIter := C.PyObject_GetIter(pySet)
+	if pyIter == nil {
+		err = getError()
+		return
+	}
+	defer C.DECREF(pyIter)
+
+	set = make(map[interface{}]struct{})
+
+	for {
+		pyItem := C.PyIter_Next(pyIter)
+		if pyItem == nil {
+			if C.PyErr_Occurred() != nil {
+				err = getError()
+			}
+			return
+		}
+
+		item, err := decodeKey(pyItem)
+		C.DECREF(pyItem)
+		if err != nil {
+			return nil, err
+		}
+
+		set[item] = struct{}{}
+	}
+}
+
+// decodeKey translates a Python object to a Go value which can be used as a
+// map key.
+func decodeKey(pyValue *C.PyObject) (key interface{}, err error) {
+	if key, err = decode(pyValue); err != nil {
+		return
+	}
+
+	if key != nil && !reflect.TypeOf(key).Comparable() {
+		err = fmt.Errorf("unable to translate %s from Python to a Go map key", stringify(pyValue))
+		key = nil
+	}
+	return
+}
+
 // decodeMapping translates a Python object to a Go map.
 func decodeMapping(pyMapping *C.PyObject) (mapping map[interface{}]interface{}, err error) {
 	mapping = make(map[interface{}]interface{})
 
-	pyItems := C.Mapping_Items(pyMapping)
+	pyItems := mappingItems(pyMapping)
 	if pyItems == nil {
 		err = getError()
 		return
 	}
+	defer C.Py_DecRef(pyItems)
 
-	length := int(C.PyList_Size(pyItems))
+	length := int(C.PySequence_Size(pyItems))
+	if length < 0 {
+		err = getError()
+		return
+	}
 
 	for i := 0; i < length; i++ {
-		pyPair := C.PyList_GetItem(pyItems, C.Py_ssize_t(i))
-
-		var (
-			key   interface{}
-			value interface{}
-		)
-
-		if key, err = decode(C.PyTuple_GetItem(pyPair, 0)); err != nil {
+		pyPair := C.PySequence_GetItem(pyItems, C.Py_ssize_t(i))
+		if pyPair == nil {
+			err = getError()
 			return
 		}
 
-		if value, err = decode(C.PyTuple_GetItem(pyPair, 1)); err != nil {
+		err = decodeMappingItem(mapping, pyPair)
+		C.Py_DecRef(pyPair)
+		if err != nil {
 			return
 		}
+	}
 
-		mapping[key] = value
+	return
+}
+
+func decodeMappingItem(mapping map[interface{}]interface{}, pyPair *C.PyObject) (err error) {
+	pyKey, pyValue, err := unpackPair(pyPair)
+	if err != nil {
+		return
 	}
 
+	key, err := decodeKey(pyKey)
+	if err != nil {
+		return
+	}
+
+	value, err := decode(pyValue)
+	if err != nil {
+		return
+	}
+
+	mapping[key] = value
+	return
+}
+
+// mappingItems gets a new reference to the (key, value) pairs of a mapping.
+// It is a list for dicts, but mappings with a custom items() method may return
+// any sequence.
+func mappingItems(pyMapping *C.PyObject) *C.PyObject {
+	return C.Mapping_Items(pyMapping)
+}
+
+// unpackPair gets borrowed references to the items of a (key, value) tuple.
+func unpackPair(pyPair *C.PyObject) (pyKey, pyValue *C.PyObject, err error) {
+	if C.Pair_Unpack(pyPair, &pyKey, &pyValue) == 0 {
+		err = getError()
+	}
 	return
 }
 
@@ -857,6 +1567,10 @@ func getError() error {
 
 	C.PyErr_Clear()
 
+	if t := lookupThread(); t != nil {
+		t.metrics.errors.Add(1)
+	}
+
 	return fmt.Errorf("Python: %s", stringify(pyValue))
 }
 
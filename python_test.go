@@ -1,8 +1,21 @@
 package python_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/big"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/tsavola/go-python"
 )
@@ -247,3 +260,2363 @@ func TestThreads(t *testing.T) {
 		fmt.Printf("done %d/3\n", i+1)
 	}
 }
+
+func TestRepr(t *testing.T) {
+	module, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := module.Call(nil, "str", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, err := s.Repr(nil); err != nil {
+		t.Fatal(err)
+	} else if r != "'foo'" {
+		t.Error(r)
+	}
+
+	if r, err := s.Str(nil); err != nil {
+		t.Fatal(err)
+	} else if r != "foo" {
+		t.Error(r)
+	}
+
+	if r := fmt.Sprintf("%v %#v %q", s, s, s); r != `foo 'foo' "foo"` {
+		t.Error(r)
+	}
+
+	if r := fmt.Sprintf("%5v|%-#7v|%.2s|%6q", s, s, s, s); r != `  foo|'foo'  |fo| "foo"` {
+		t.Error(r)
+	}
+
+	class, err := module.Call(nil, "type", "Broken", []interface{}{}, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eval, err := module.Attr(nil, "eval")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raiser, err := eval.Invoke(nil, "lambda self: 1 // 0", map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := module.Call(nil, "setattr", class, "__str__", raiser); err != nil {
+		t.Fatal(err)
+	}
+
+	instance, err := class.Invoke(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := instance.Str(nil); err == nil {
+		t.Error("no error")
+	} else {
+		t.Log(err)
+	}
+
+	if _, err := instance.Repr(nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	module, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const text = "ääkkönen"
+
+	u, err := module.Call(nil, "unicode", python.Bytes(text), "utf-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, err := u.Repr(nil); err != nil {
+		t.Fatal(err)
+	} else if r != `u'\xe4\xe4kk\xf6nen'` {
+		t.Error(r)
+	}
+
+	if v, err := u.Value(nil); err != nil {
+		t.Fatal(err)
+	} else if v.(string) != text {
+		t.Error(v)
+	}
+
+	if n, err := module.CallValue(nil, "len", python.Unicode(text)); err != nil {
+		t.Fatal(err)
+	} else if n.(int) != 8 {
+		t.Error(n)
+	}
+
+	if n, err := module.CallValue(nil, "len", python.Bytes(text)); err != nil {
+		t.Fatal(err)
+	} else if n.(int) != 11 {
+		t.Error(n)
+	}
+
+	python.UnicodeStrings = true
+	defer func() { python.UnicodeStrings = false }()
+
+	if n, err := module.CallValue(nil, "len", text); err != nil {
+		t.Fatal(err)
+	} else if n.(int) != 8 {
+		t.Error(n)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	module, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("foo\x00bar\xff")
+
+	if v, err := module.CallValue(nil, "str", data); err != nil {
+		t.Fatal(err)
+	} else if v.(string) != string(data) {
+		t.Errorf("%q", v)
+	}
+
+	if v, err := module.CallValue(nil, "bytearray", data); err != nil {
+		t.Fatal(err)
+	} else if string(v.([]byte)) != string(data) {
+		t.Errorf("%q", v)
+	}
+
+	if v, err := module.Call(nil, "type", python.ByteArray(data)); err != nil {
+		t.Fatal(err)
+	} else if s := v.String(); s != "<type 'bytearray'>" {
+		t.Error(s)
+	}
+
+	if v, err := module.CallValue(nil, "len", []byte{}); err != nil {
+		t.Fatal(err)
+	} else if v.(int) != 0 {
+		t.Error(v)
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	module, err := python.Import(nil, "array")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	array, err := module.Call(nil, "array", "d", []interface{}{1.5, 2.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := array.Buffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	floats, err := buf.Float64s()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(floats) != 2 || floats[0] != 1.5 || floats[1] != 2.5 {
+		t.Error(floats)
+	}
+
+	if _, err := buf.Int32s(); err == nil {
+		t.Error("no error")
+	}
+
+	floats[1] = 3.5
+
+	buf.Release(nil)
+
+	if v, err := array.ItemValue(nil, 1); err != nil {
+		t.Fatal(err)
+	} else if v.(float64) != 3.5 {
+		t.Error(v)
+	}
+
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bytearray, err := builtin.Call(nil, "bytearray", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err = bytearray.Buffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(buf.Bytes()); s != "foo" || buf.ReadOnly() {
+		t.Error(s)
+	}
+	buf.Release(nil)
+}
+
+func TestMemoryView(t *testing.T) {
+	data := []byte("foo")
+
+	view, err := python.NewMemoryView(nil, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := view.Call(nil, "__setitem__", 0, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "boo" {
+		t.Error(string(data))
+	}
+
+	ints := []int32{1, 2, 3}
+
+	view, err = python.NewMemoryView(nil, ints)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	module, err := python.Import(nil, "array")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	array, err := module.Call(nil, "array", "i")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := view.Call(nil, "tobytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := array.Call(nil, "fromstring", raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := array.CallValue(nil, "tolist"); err != nil {
+		t.Fatal(err)
+	} else if fmt.Sprint(v) != "[1 2 3]" {
+		t.Error(v)
+	}
+
+	if v, err := view.AttrValue(nil, "shape"); err != nil {
+		t.Fatal(err)
+	} else if fmt.Sprint(v) != "[3]" {
+		t.Error(v)
+	}
+}
+
+func TestBigInt(t *testing.T) {
+	module, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{
+		"123456789012345678901234567890",
+		"-123456789012345678901234567890",
+		"-9223372036854775809",
+		"18446744073709551616",
+	} {
+		i, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			t.Fatal(s)
+		}
+
+		if v, err := module.CallValue(nil, "long", s); err != nil {
+			t.Fatal(err)
+		} else if v.(*big.Int).Cmp(i) != 0 {
+			t.Error(v)
+		}
+
+		if v, err := module.CallValue(nil, "str", i); err != nil {
+			t.Fatal(err)
+		} else if v.(string) != s {
+			t.Error(v)
+		}
+
+		if v, err := module.CallValue(nil, "str", *i); err != nil {
+			t.Fatal(err)
+		} else if v.(string) != s {
+			t.Error(v)
+		}
+	}
+
+	if v, err := module.CallValue(nil, "long", "-9223372036854775808"); err != nil {
+		t.Fatal(err)
+	} else if v.(int64) != -9223372036854775808 {
+		t.Error(v)
+	}
+
+	if v, err := module.CallValue(nil, "str", new(big.Int)); err != nil {
+		t.Fatal(err)
+	} else if v.(string) != "0" {
+		t.Error(v)
+	}
+
+	if v, err := module.CallValue(nil, "repr", (*big.Int)(nil)); err != nil {
+		t.Fatal(err)
+	} else if v.(string) != "None" {
+		t.Error(v)
+	}
+}
+
+func TestStringLeak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("slow")
+	}
+
+	module, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := module.Attr(nil, "len")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := strings.Repeat("x", 100)
+	u := python.Unicode(s)
+
+	call := func(n int) {
+		for i := 0; i < n; i++ {
+			if _, err := f.Invoke(nil, s, u); err == nil {
+				t.Fatal("len accepted two arguments")
+			}
+		}
+	}
+
+	call(10000)
+	before := residentSetSize(t)
+	call(2000000)
+	after := residentSetSize(t)
+
+	t.Logf("resident set size grew by %d bytes", after-before)
+
+	if after-before > 50*1024*1024 {
+		t.Error("memory leak")
+	}
+
+	if n, err := f.InvokeValue(nil, python.Unicode("")); err != nil {
+		t.Fatal(err)
+	} else if n.(int) != 0 {
+		t.Error(n)
+	}
+}
+
+func residentSetSize(t *testing.T) int64 {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	var size, resident int64
+
+	if _, err := fmt.Sscan(string(data), &size, &resident); err != nil {
+		t.Fatal(err)
+	}
+
+	return resident * int64(os.Getpagesize())
+}
+
+func TestSequenceTypes(t *testing.T) {
+	module, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, x := range []struct {
+		value interface{}
+		repr  string
+	}{
+		{[]interface{}{1, 2}, "(1, 2)"},
+		{python.List{1, 2}, "[1, 2]"},
+		{python.Tuple{1, 2}, "(1, 2)"},
+		{python.List{}, "[]"},
+		{python.Set{1: {}}, "set([1])"},
+		{python.FrozenSet{"a": {}}, "frozenset(['a'])"},
+	} {
+		if s, err := module.CallValue(nil, "repr", x.value); err != nil {
+			t.Fatal(err)
+		} else if s.(string) != x.repr {
+			t.Errorf("%v: %s", x.value, s)
+		}
+	}
+
+	list, err := module.Call(nil, "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := module.CallValue(nil, "repr", python.Set{list: {}}); err == nil {
+		t.Error("unhashable set item accepted")
+	}
+
+	python.ListSlices = true
+	defer func() { python.ListSlices = false }()
+
+	if s, err := module.CallValue(nil, "repr", []interface{}{1, 2}); err != nil {
+		t.Fatal(err)
+	} else if s.(string) != "[1, 2]" {
+		t.Error(s)
+	}
+
+	if s, err := module.CallValue(nil, "repr", python.Tuple{1}); err != nil {
+		t.Fatal(err)
+	} else if s.(string) != "(1,)" {
+		t.Error(s)
+	}
+}
+
+func TestDecodeSets(t *testing.T) {
+	module, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := module.CallValue(nil, "set", python.List{1, "a", 1}); err != nil {
+		t.Fatal(err)
+	} else if set := v.(python.Set); len(set) != 2 {
+		t.Error(set)
+	} else if _, found := set["a"]; !found {
+		t.Error(set)
+	}
+
+	if v, err := module.CallValue(nil, "frozenset", python.List{2}); err != nil {
+		t.Fatal(err)
+	} else if set := v.(python.FrozenSet); len(set) != 1 {
+		t.Error(set)
+	}
+
+	if _, err := module.CallValue(nil, "set", python.List{python.Tuple{1, 2}}); err == nil {
+		t.Error("tuple decoded as Go map key")
+	} else {
+		t.Log(err)
+	}
+
+	if v, err := module.CallValue(nil, "tuple", python.List{1}); err != nil {
+		t.Fatal(err)
+	} else if _, ok := v.([]interface{}); !ok {
+		t.Errorf("%T", v)
+	}
+
+	python.TypedSequences = true
+	defer func() { python.TypedSequences = false }()
+
+	if v, err := module.CallValue(nil, "tuple", python.List{1}); err != nil {
+		t.Fatal(err)
+	} else if _, ok := v.(python.Tuple); !ok {
+		t.Errorf("%T", v)
+	}
+
+	if v, err := module.CallValue(nil, "list", python.Tuple{1}); err != nil {
+		t.Fatal(err)
+	} else if _, ok := v.(python.List); !ok {
+		t.Errorf("%T", v)
+	}
+}
+
+func TestDateTime(t *testing.T) {
+	module, err := python.Import(nil, "datetime")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	class, err := module.Attr(nil, "datetime")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := class.InvokeValue(nil, 2016, 2, 29, 12, 30, 45, 123456); err != nil {
+		t.Fatal(err)
+	} else if v := v.(time.Time); !v.Equal(time.Date(2016, 2, 29, 12, 30, 45, 123456000, time.Local)) {
+		t.Error(v)
+	}
+
+	zone := time.FixedZone("EET", 2*60*60)
+	orig := time.Date(2016, 2, 29, 12, 30, 45, 123456789, zone)
+
+	if s, err := class.CallValue(nil, "isoformat", orig); err != nil {
+		t.Fatal(err)
+	} else if s.(string) != "2016-02-29T12:30:45.123456+02:00" {
+		t.Error(s)
+	}
+
+	if v, err := class.CallValue(nil, "replace", orig); err != nil {
+		t.Fatal(err)
+	} else if v := v.(time.Time); !v.Equal(orig.Truncate(time.Microsecond)) || v.Location().String() != "EET" {
+		t.Error(v)
+	}
+
+	if v, err := class.CallValue(nil, "replace", orig.UTC()); err != nil {
+		t.Fatal(err)
+	} else if v.(time.Time).Location() != time.UTC {
+		t.Error(v)
+	}
+
+	delta, err := module.Attr(nil, "timedelta")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range []time.Duration{0, 1500 * time.Millisecond, -time.Microsecond, 1000 * time.Hour, -90 * time.Minute} {
+		if v, err := delta.CallValue(nil, "__pos__", d); err != nil {
+			t.Fatal(err)
+		} else if v.(time.Duration) != d {
+			t.Error(d, v)
+		}
+	}
+
+	if v, err := module.CallValue(nil, "timedelta", 3, 4, 5); err != nil {
+		t.Fatal(err)
+	} else if v.(time.Duration) != 72*time.Hour+4*time.Second+5*time.Microsecond {
+		t.Error(v)
+	}
+
+	if _, err := module.CallValue(nil, "timedelta", 999999999); err == nil {
+		t.Error("out of range timedelta accepted")
+	}
+
+	// The largest time.Duration is 106751 days, 85636.854775807 seconds.
+	maxDelta := time.Duration(math.MaxInt64) / time.Microsecond * time.Microsecond
+
+	if v, err := module.CallValue(nil, "timedelta", 106751, 85636, 854775); err != nil {
+		t.Fatal(err)
+	} else if v.(time.Duration) != maxDelta {
+		t.Error(v)
+	}
+
+	if v, err := module.CallValue(nil, "timedelta", -106751, -85636, -854775); err != nil {
+		t.Fatal(err)
+	} else if v.(time.Duration) != -maxDelta {
+		t.Error(v)
+	}
+
+	for _, args := range [][]interface{}{{106751, 85636, 854776}, {106751, 86399}, {-106752, -86399}} {
+		if v, err := module.CallValue(nil, "timedelta", args...); err == nil {
+			t.Errorf("timedelta%v: %v", args, v)
+		}
+	}
+
+	date := python.Date{Year: 2016, Month: time.February, Day: 29}
+
+	if v, err := module.CallValue(nil, "date", 2016, 2, 29); err != nil {
+		t.Fatal(err)
+	} else if v.(python.Date) != date {
+		t.Error(v)
+	}
+
+	dateClass, err := module.Attr(nil, "date")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := dateClass.CallValue(nil, "isoformat", date); err != nil {
+		t.Fatal(err)
+	} else if s.(string) != "2016-02-29" {
+		t.Error(s)
+	}
+
+	clock := python.TimeOfDay{Hour: 23, Minute: 59, Second: 1, Microsecond: 2}
+
+	timeClass, err := module.Attr(nil, "time")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := timeClass.CallValue(nil, "replace", clock); err != nil {
+		t.Fatal(err)
+	} else if v.(python.TimeOfDay) != clock {
+		t.Error(v)
+	}
+
+	clock.Location = zone
+
+	if s, err := timeClass.CallValue(nil, "isoformat", clock); err != nil {
+		t.Fatal(err)
+	} else if s.(string) != "23:59:01.000002+02:00" {
+		t.Error(s)
+	}
+
+	if v, err := timeClass.CallValue(nil, "replace", clock); err != nil {
+		t.Fatal(err)
+	} else if v := v.(python.TimeOfDay); v.Location.String() != "EET" {
+		t.Error(v)
+	}
+}
+
+type point struct {
+	x, y int
+}
+
+func (p point) MarshalPython() (interface{}, error) {
+	return python.Tuple{p.x, p.y}, nil
+}
+
+func (p *point) UnmarshalPython(o python.Object) (err error) {
+	var xy []int
+
+	if err = o.Unmarshal(nil, &xy); err != nil {
+		return
+	}
+	if len(xy) != 2 {
+		return fmt.Errorf("point has %d coordinates", len(xy))
+	}
+
+	p.x, p.y = xy[0], xy[1]
+	return
+}
+
+func TestCodecs(t *testing.T) {
+	thread := python.NewThread()
+	defer thread.Close()
+
+	module, err := python.Import(thread, "fractions")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	class, err := module.Attr(thread, "Fraction")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoder := func(o python.Object) (interface{}, error) {
+		num, err := o.AttrValue(thread, "numerator")
+		if err != nil {
+			return nil, err
+		}
+
+		den, err := o.AttrValue(nil, "denominator")
+		if err != nil {
+			return nil, err
+		}
+
+		return big.NewRat(int64(num.(int)), int64(den.(int))), nil
+	}
+
+	if err := python.RegisterDecoder(class, decoder); err != nil {
+		t.Fatal(err)
+	}
+	defer python.RegisterDecoder(class, nil)
+
+	if v, err := class.InvokeValue(thread, 6, 4); err != nil {
+		t.Fatal(err)
+	} else if v.(*big.Rat).String() != "3/2" {
+		t.Error(v)
+	}
+
+	builtin, err := python.Import(thread, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := builtin.CallValue(thread, "repr", []interface{}{point{1, 2}}); err != nil {
+		t.Fatal(err)
+	} else if v.(string) != "((1, 2),)" {
+		t.Error(v)
+	}
+
+	list, err := builtin.Call(thread, "list", python.List{python.Tuple{3, 4}, python.List{5, 6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var points []point
+
+	if err := list.Unmarshal(thread, &points); err != nil {
+		t.Fatal(err)
+	} else if fmt.Sprint(points) != "[{3 4} {5 6}]" {
+		t.Error(points)
+	}
+
+	dict, err := builtin.Call(thread, "dict", python.List{python.Tuple{"a", []byte("xyz")}, python.Tuple{"b", nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var bytes map[string][]byte
+
+	if err := dict.Unmarshal(thread, &bytes); err != nil {
+		t.Fatal(err)
+	} else if string(bytes["a"]) != "xyz" || bytes["b"] != nil || len(bytes) != 2 {
+		t.Error(bytes)
+	}
+
+	var small map[string]int8
+
+	number, err := builtin.Call(thread, "dict", python.List{python.Tuple{"a", 1000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := number.Unmarshal(thread, &small); err == nil {
+		t.Error(small)
+	} else {
+		t.Log(err)
+	}
+
+	huge, err := builtin.Call(thread, "eval", `(-2**70, 5)`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pointers []*big.Int
+
+	if err := huge.Unmarshal(thread, &pointers); err != nil {
+		t.Fatal(err)
+	} else if len(pointers) != 2 || pointers[0].String() != "-1180591620717411303424" || pointers[1].Int64() != 5 {
+		t.Error(pointers)
+	}
+
+	var fields struct {
+		Big   big.Int
+		Small big.Int
+	}
+
+	top, err := huge.Item(thread, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var i *big.Int
+
+	if err := top.Unmarshal(thread, &i); err != nil {
+		t.Fatal(err)
+	} else if i.String() != "-1180591620717411303424" {
+		t.Error(i)
+	}
+
+	hugeDict, err := builtin.Call(thread, "eval", `{"big": -2**70, "small": 5}`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hugeDict.Unmarshal(thread, &fields); err != nil {
+		t.Fatal(err)
+	} else if fields.Big.String() != "-1180591620717411303424" || fields.Small.Int64() != 5 {
+		t.Error(fields.Big.String(), fields.Small.String())
+	}
+
+	floats, err := builtin.Call(thread, "eval", `[float("nan"), 0.1, -1e300]`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var narrow []float32
+
+	if err := floats.Unmarshal(thread, &narrow); err == nil {
+		t.Error(narrow)
+	} else {
+		t.Log(err)
+	}
+
+	floats, err = builtin.Call(thread, "eval", `[float("nan"), 0.1, float("-inf")]`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := floats.Unmarshal(thread, &narrow); err != nil {
+		t.Error(err)
+	} else if !math.IsNaN(float64(narrow[0])) || narrow[1] != 0.1 || !math.IsInf(float64(narrow[2]), -1) {
+		t.Error(narrow)
+	}
+
+	for _, m := range []python.Marshaler{selfMarshaler{1}, loopMarshaler{}} {
+		if _, err := builtin.Call(thread, "repr", m); err == nil {
+			t.Errorf("%#v", m)
+		} else {
+			t.Log(err)
+		}
+	}
+}
+
+type selfMarshaler []int
+
+func (m selfMarshaler) MarshalPython() (interface{}, error) {
+	return m, nil
+}
+
+type loopMarshaler map[string]int
+
+func (m loopMarshaler) MarshalPython() (interface{}, error) {
+	return otherMarshaler{m}, nil
+}
+
+type otherMarshaler struct {
+	m loopMarshaler
+}
+
+func (m otherMarshaler) MarshalPython() (interface{}, error) {
+	return m.m, nil
+}
+
+func TestDecimalAndUUID(t *testing.T) {
+	decimal, err := python.Import(nil, "decimal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	class, err := decimal.Attr(nil, "Decimal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuid, err := python.Import(nil, "uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uuidClass, err := uuid.Attr(nil, "UUID")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := python.RegisterDecimalDecoder(); err != nil {
+		t.Fatal(err)
+	}
+	defer python.RegisterDecoder(class, nil)
+
+	if err := python.RegisterUUIDDecoder(); err != nil {
+		t.Fatal(err)
+	}
+	defer python.RegisterDecoder(uuidClass, nil)
+
+	if v, err := decimal.CallValue(nil, "Decimal", "12.50"); err != nil {
+		t.Fatal(err)
+	} else if v.(python.Decimal) != "12.50" {
+		t.Error(v)
+	}
+
+	if v, err := class.CallValue(nil, "__add__", python.Decimal("0.1"), python.Decimal("0.2")); err != nil {
+		t.Fatal(err)
+	} else if d := v.(python.Decimal); d != "0.3" {
+		t.Error(d)
+	} else if r, ok := d.Rat(); !ok || r.String() != "3/10" {
+		t.Error(r)
+	}
+
+	const s = "12345678-1234-5678-9abc-def012345678"
+
+	v, err := uuid.CallValue(nil, "UUID", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := v.(python.UUID)
+	if u.String() != s {
+		t.Error(u)
+	}
+
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := builtin.CallValue(nil, "str", u); err != nil {
+		t.Fatal(err)
+	} else if v.(string) != s {
+		t.Error(v)
+	}
+}
+
+type person struct {
+	FirstName  string
+	Age        int    `py:"years"`
+	Ignored    string `py:"-"`
+	Tags       []string
+	Manager    *person
+	unexported int
+}
+
+func TestUnmarshalStruct(t *testing.T) {
+	collections, err := python.Import(nil, "collections")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	class, err := collections.Call(nil, "namedtuple", "Person", python.List{"first_name", "years", "tags", "manager"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	boss, err := class.Invoke(nil, "Alice", 50, python.List{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	employee, err := class.Invoke(nil, "Bob", 30, python.Tuple{"x", "y"}, boss)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p person
+
+	if err := employee.Unmarshal(nil, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.FirstName != "Bob" || p.Age != 30 || len(p.Tags) != 2 || p.Manager == nil || p.Manager.FirstName != "Alice" || p.Manager.Manager != nil {
+		t.Errorf("%#v", p)
+	}
+
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dict := map[interface{}]interface{}{
+		"FIRSTNAME": "Carol",
+		"years":     40,
+		"Ignored":   "foo",
+		"other":     true,
+	}
+
+	p = person{}
+
+	if d, err := builtin.Call(nil, "dict", dict); err != nil {
+		t.Fatal(err)
+	} else if err := d.Unmarshal(nil, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.FirstName != "Carol" || p.Age != 40 || p.Ignored != "" {
+		t.Errorf("%#v", p)
+	}
+
+	eval, err := builtin.Attr(nil, "eval")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	factory, err := eval.Invoke(nil, "lambda attrs: (lambda o: o.__dict__.update(attrs) or o)(type('Object', (object,), {'tags': ['class']})())", map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	object, err := factory.Invoke(nil, map[interface{}]interface{}{"first_name": "Dave", "years": 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p = person{}
+
+	if err := object.Unmarshal(nil, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.FirstName != "Dave" || p.Age != 20 || p.Tags != nil {
+		t.Errorf("%#v", p)
+	}
+
+	object, err = factory.Invoke(nil, map[interface{}]interface{}{"first_name": "Dave", "years": "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := object.Unmarshal(nil, &p); err == nil {
+		t.Errorf("%#v", p)
+	} else {
+		t.Log(err)
+	}
+
+	if err := python.Object(boss).Unmarshal(nil, &struct{ X int }{}); err != nil {
+		t.Error(err)
+	}
+
+	var number struct{ Real int }
+
+	if n, err := builtin.Call(nil, "int", 5); err != nil {
+		t.Fatal(err)
+	} else if err := n.Unmarshal(nil, &number); err == nil {
+		t.Errorf("%#v", number)
+	} else {
+		t.Log(err)
+	}
+
+	listPairs, err := eval.Invoke(nil, `type("D", (dict,), {"items": lambda self: [["years", 1]]})()`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := listPairs.Unmarshal(nil, &p); err == nil {
+		t.Errorf("%#v", p)
+	}
+
+	var m map[string]int
+
+	if err := listPairs.Unmarshal(nil, &m); err == nil {
+		t.Errorf("%#v", m)
+	}
+
+	python.TypedSequences = true
+	defer func() { python.TypedSequences = false }()
+
+	var typed struct {
+		FirstName string
+		Module    string
+		Count     int
+	}
+
+	if err := employee.Unmarshal(nil, &typed); err != nil {
+		t.Fatal(err)
+	}
+	if typed.FirstName != "Bob" || typed.Module != "" || typed.Count != 0 {
+		t.Errorf("%#v", typed)
+	}
+}
+
+type account struct {
+	Owner   string `py:"owner"`
+	Balance int64  `py:"balance"`
+	Tags    []string
+	Secret  string `py:"-"`
+	Parent  *account
+}
+
+func TestEncodeStruct(t *testing.T) {
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := account{
+		Owner:   "alice",
+		Balance: 100,
+		Tags:    []string{"x"},
+		Secret:  "hidden",
+	}
+
+	if v, err := builtin.CallValue(nil, "sorted", a); err != nil {
+		t.Fatal(err)
+	} else if fmt.Sprint(v) != "[Parent Tags balance owner]" {
+		t.Error(v)
+	}
+
+	python.StructObjects = true
+	defer func() { python.StructObjects = false }()
+
+	o, err := builtin.Call(nil, "repr", &a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := o.String(); s != "account(owner='alice', balance=100L, Tags=('x',), Parent=None)" {
+		t.Error(s)
+	}
+
+	attrgetter, err := python.Import(nil, "operator")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter, err := attrgetter.Call(nil, "attrgetter", "Parent.owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := getter.InvokeValue(nil, account{Parent: &a}); err != nil {
+		t.Fatal(err)
+	} else if v.(string) != "alice" {
+		t.Error(v)
+	}
+
+	nt, err := builtin.Call(nil, "tuple", python.List{a})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := nt.Item(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b account
+
+	if err := item.Unmarshal(nil, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Owner != a.Owner || b.Balance != a.Balance || len(b.Tags) != 1 || b.Secret != "" {
+		t.Errorf("%#v", b)
+	}
+
+	if _, err := builtin.Call(nil, "repr", func() {}); err == nil {
+		t.Error("function translated")
+	}
+
+	loop := &account{Owner: "loop"}
+	loop.Parent = loop
+
+	if _, err := builtin.Call(nil, "repr", loop); err == nil {
+		t.Error("circular reference translated")
+	} else {
+		t.Log(err)
+	}
+
+	loopMap := map[string]interface{}{}
+	loopMap["self"] = loopMap
+
+	loopDict := map[interface{}]interface{}{}
+	loopDict["self"] = []interface{}{loopDict}
+
+	loopSlice := make(python.List, 1)
+	loopSlice[0] = loopSlice
+
+	for _, value := range []interface{}{loopMap, loopDict, loopSlice} {
+		if _, err := builtin.Call(nil, "repr", value); err == nil {
+			t.Errorf("circular %T translated", value)
+		} else {
+			t.Log(err)
+		}
+	}
+
+	shared := []interface{}{1}
+
+	if v, err := builtin.CallValue(nil, "repr", map[string]interface{}{"a": shared, "b": shared}); err != nil {
+		t.Fatal(err)
+	} else if v.(string) != "{'a': (1,), 'b': (1,)}" {
+		t.Error(v)
+	}
+
+	if v, err := builtin.CallValue(nil, "len", []*account{&a, &a}); err != nil {
+		t.Fatal(err)
+	} else if v.(int) != 2 {
+		t.Error(v)
+	}
+
+	if v, err := builtin.CallValue(nil, "repr", []interface{}{blob("ab"), [2]byte{'c', 'd'}}); err != nil {
+		t.Fatal(err)
+	} else if v.(string) != "('ab', 'cd')" {
+		t.Error(v)
+	}
+}
+
+type blob []byte
+
+type inventory struct {
+	Name  string
+	Items map[string]int
+	Log   []string
+	Owner *person
+}
+
+func (inv *inventory) Add(name string, count int) int {
+	inv.Items[name] += count
+	inv.Log = append(inv.Log, name)
+	return inv.Items[name]
+}
+
+func (inv *inventory) Remove(name string) error {
+	if _, found := inv.Items[name]; !found {
+		return fmt.Errorf("no %s", name)
+	}
+	delete(inv.Items, name)
+	return nil
+}
+
+func (inv *inventory) Describe(thread *python.Thread, o python.Object) (string, error) {
+	return o.Str(thread)
+}
+
+func TestProxy(t *testing.T) {
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eval, err := builtin.Attr(nil, "eval")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := eval.Invoke(nil, `lambda inv: (
+		setattr(inv, "name", inv.name.upper()),
+		inv.add("apple", 2),
+		inv.add("apple", 3),
+		inv.items.__setitem__("pear", 1),
+		setattr(inv.owner, "years", inv.owner.years + 1),
+		inv.log.__setitem__(-1, "APPLE"),
+		len(inv.items),
+		sorted(inv.items),
+		[x for x in inv.log],
+		inv.describe(42),
+	)`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv := &inventory{
+		Name:  "store",
+		Items: make(map[string]int),
+		Owner: &person{FirstName: "Eve", Age: 20},
+	}
+
+	result, err := script.InvokeValue(nil, python.Proxy(inv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := fmt.Sprint(result); s != "[<nil> 2 5 <nil> <nil> <nil> 2 [apple pear] [apple APPLE] 42]" {
+		t.Error(s)
+	}
+
+	if inv.Name != "STORE" || inv.Items["apple"] != 5 || inv.Items["pear"] != 1 || inv.Owner.Age != 21 || inv.Log[1] != "APPLE" {
+		t.Errorf("%#v", inv)
+	}
+
+	fail, err := eval.Invoke(nil, `lambda inv, name: inv.remove(name)`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fail.Invoke(nil, python.Proxy(inv), "pear"); err != nil {
+		t.Error(err)
+	}
+	if _, err := fail.Invoke(nil, python.Proxy(inv), "pear"); err == nil {
+		t.Error("no error")
+	} else {
+		t.Log(err)
+	}
+
+	if _, err := builtin.Call(nil, "getattr", python.Proxy(inv), "nothing"); err == nil {
+		t.Error("no error")
+	}
+
+	if v, err := builtin.CallValue(nil, "hasattr", python.Proxy(inv), "nothing"); err != nil {
+		t.Fatal(err)
+	} else if v.(bool) {
+		t.Error(v)
+	}
+
+	if _, err := builtin.Call(nil, "iter", python.Proxy(inv)); err == nil {
+		t.Error("no error")
+	}
+
+	if v, err := builtin.CallValue(nil, "list", python.Proxy(inv.Log)); err != nil {
+		t.Fatal(err)
+	} else if fmt.Sprint(v) != "[apple APPLE]" {
+		t.Error(v)
+	}
+
+	if v, err := builtin.CallValue(nil, "repr", python.Proxy(inv)); err != nil {
+		t.Fatal(err)
+	} else if v.(string) != "<go.proxy *python_test.inventory>" {
+		t.Error(v)
+	}
+
+	double := func(x int) int { return x * 2 }
+
+	if v, err := builtin.CallValue(nil, "map", python.Proxy(double), python.List{1, 2}); err != nil {
+		t.Fatal(err)
+	} else if fmt.Sprint(v) != "[2 4]" {
+		t.Error(v)
+	}
+
+	var back *inventory
+
+	identity, err := eval.Invoke(nil, `lambda x: x`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := identity.Invoke(nil, python.Proxy(inv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.Unmarshal(nil, &back); err != nil {
+		t.Fatal(err)
+	} else if back != inv {
+		t.Error(back)
+	}
+}
+
+type counter struct {
+	Label  string
+	Counts map[string]int
+	hidden int
+}
+
+func (c *counter) PyInit(label string) {
+	c.Label = label
+	c.Counts = make(map[string]int)
+}
+
+func (c *counter) PyLen() int {
+	return len(c.Counts)
+}
+
+func (c *counter) PyGetItem(key string) int {
+	return c.Counts[key]
+}
+
+func (c *counter) PyRepr() string {
+	return fmt.Sprintf("counter(%q)", c.Label)
+}
+
+func (c *counter) AddMany(keys ...string) (int, error) {
+	for _, key := range keys {
+		if key == "" {
+			return 0, fmt.Errorf("empty key")
+		}
+		c.Counts[key]++
+	}
+	return len(keys), nil
+}
+
+func (c *counter) Clone() *counter {
+	clone := &counter{Label: c.Label + "'", Counts: make(map[string]int)}
+	for key, n := range c.Counts {
+		clone.Counts[key] = n
+	}
+	return clone
+}
+
+type labelled struct {
+	Label    string
+	ItemID   int `py:"item"`
+	Internal int `py:"-"`
+}
+
+func TestClass(t *testing.T) {
+	class, err := python.NewClass(nil, "Counter", (*counter)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := python.NewClass(nil, "Counter2", counter{}); err == nil {
+		t.Error("same struct type defined twice")
+	}
+
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eval, err := builtin.Attr(nil, "eval")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := eval.Invoke(nil, `lambda Counter: (
+		lambda c: (
+			c.add_many("a", "b", "a"),
+			len(c),
+			c["a"],
+			c.label,
+			repr(c),
+			repr(c.clone()),
+			c.clone()["b"],
+			isinstance(c, Counter),
+			c,
+		)
+	)(Counter("x"))`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := script.Invoke(nil, class)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []interface{}
+	if err := result.Unmarshal(nil, &items); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := fmt.Sprint(items[:8]); s != `[3 2 2 x counter("x") counter("x'") 1 true]` {
+		t.Error(s)
+	}
+
+	if c, ok := items[8].(*counter); !ok || c.Label != "x" || c.Counts["a"] != 2 {
+		t.Errorf("%#v", items[8])
+	}
+
+	if _, err := class.Invoke(nil); err == nil {
+		t.Error("__init__ without arguments")
+	}
+
+	sub, err := eval.Invoke(nil, `lambda Counter: type("Sub", (Counter,), {
+		"__init__": lambda self, label: (Counter.__init__(self, label.upper()), setattr(self, "extra", 1))[0],
+		"add_many": lambda self, *keys: Counter.add_many(self, *(keys + keys)),
+	})`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subclass, err := sub.Invoke(nil, class)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := subclass.Invoke(nil, "y")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := o.CallValue(nil, "add_many", "z"); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Error(n)
+	}
+
+	if _, err := o.Call(nil, "add_many", ""); err == nil {
+		t.Error("no error")
+	}
+
+	if v, err := o.AttrValue(nil, "extra"); err != nil || v != 1 {
+		t.Error(v, err)
+	}
+
+	var c *counter
+	if err := o.Unmarshal(nil, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Label != "Y" || c.Counts["z"] != 2 {
+		t.Errorf("%#v", c)
+	}
+
+	class2, err := python.NewClass(nil, "Labelled", labelled{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	init, err := eval.Invoke(nil, `lambda Labelled: Labelled(label="l", item=5)`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err = init.Invoke(nil, class2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var l *labelled
+	if err := o.Unmarshal(nil, &l); err != nil {
+		t.Fatal(err)
+	}
+	if *l != (labelled{Label: "l", ItemID: 5}) {
+		t.Errorf("%#v", l)
+	}
+
+	if _, err := o.Attr(nil, "internal"); err == nil {
+		t.Error("no error")
+	}
+
+	if _, err := builtin.Call(nil, "setattr", o, "unknown", 1); err == nil {
+		t.Error("no error")
+	}
+
+	if _, err := builtin.Call(nil, "setattr", o, "item", 8); err != nil {
+		t.Error(err)
+	} else if l.ItemID != 8 {
+		t.Error(l.ItemID)
+	}
+
+	if _, err := class2.Invoke(nil, 1); err == nil {
+		t.Error("positional argument accepted")
+	}
+}
+
+type racer struct {
+	Lap int
+}
+
+func TestClassRace(t *testing.T) {
+	var (
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		defined int
+	)
+
+	for i := 0; i < 4; i++ {
+		thread := python.NewThread()
+		defer thread.Close()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := python.NewClass(thread, "Racer", racer{}); err == nil {
+				lock.Lock()
+				defined++
+				lock.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if defined != 1 {
+		t.Errorf("defined %d times", defined)
+	}
+}
+
+func TestStdio(t *testing.T) {
+	var global, local, errors bytes.Buffer
+
+	if err := python.SetStdout(&global); err != nil {
+		t.Fatal(err)
+	}
+	defer python.SetStdout(nil)
+
+	if err := python.SetStderr(&errors); err != nil {
+		t.Fatal(err)
+	}
+	defer python.SetStderr(nil)
+
+	thread := python.NewThread()
+	defer thread.Close()
+
+	if err := thread.SetStdout(&local); err != nil {
+		t.Fatal(err)
+	}
+
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := builtin.Call(nil, "compile", `
+import sys
+print "hello", 42
+print >>sys.stderr, u"\xe4"
+sys.stdout.writelines(["a", bytearray("b"), "\n"])
+sys.stdout.flush()
+`, "<test>", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builtin.Call(nil, "eval", code, map[interface{}]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builtin.Call(thread, "eval", code, map[interface{}]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := global.String(); s != "hello 42\nab\n" {
+		t.Errorf("%q", s)
+	}
+
+	if s := local.String(); s != "hello 42\nab\n" {
+		t.Errorf("%q", s)
+	}
+
+	if s := errors.String(); s != "ä\nä\n" {
+		t.Errorf("%q", s)
+	}
+
+	if tty, err := builtin.CallValue(nil, "eval", "__import__('sys').stdout.isatty()", map[interface{}]interface{}{}); err != nil || tty != false {
+		t.Error(tty, err)
+	}
+
+	if _, err := builtin.Call(nil, "eval", "__import__('sys').stdout.write(None)", map[interface{}]interface{}{}); err == nil {
+		t.Error("no error")
+	}
+}
+
+type recordingHandler struct {
+	records *[]slog.Record
+}
+
+func (h recordingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo
+}
+
+func (h recordingHandler) Handle(ctx context.Context, r slog.Record) error {
+	*h.records = append(*h.records, r)
+	return nil
+}
+
+func (h recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h recordingHandler) WithGroup(string) slog.Handler      { return h }
+
+func TestLogHandler(t *testing.T) {
+	var records []slog.Record
+
+	handler, err := python.NewLogHandler(nil, slog.New(recordingHandler{&records}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logging, err := python.Import(nil, "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := logging.Call(nil, "getLogger", "gotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := logger.Call(nil, "addHandler", handler); err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Call(nil, "removeHandler", handler)
+
+	if _, err := logger.Call(nil, "setLevel", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := logger.Call(nil, "debug", "hidden"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := logger.Call(nil, "warning", "%s is %d", "answer", 42); err != nil {
+		t.Fatal(err)
+	}
+
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := builtin.Call(nil, "compile", `
+import logging
+try:
+	1 / 0
+except:
+	logging.getLogger("gotest").exception("failed", extra={"user": "bob", "n": 5, "obj": object()})
+`, "<test>", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builtin.Call(nil, "eval", code, map[interface{}]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 {
+		t.Fatal(records)
+	}
+
+	attrs := func(r slog.Record) map[string]interface{} {
+		m := make(map[string]interface{})
+		r.Attrs(func(a slog.Attr) bool {
+			m[a.Key] = a.Value.Any()
+			return true
+		})
+		return m
+	}
+
+	r := records[0]
+	a := attrs(r)
+
+	if r.Level != slog.LevelWarn || r.Message != "answer is 42" || a["logger"] != "gotest" {
+		t.Error(r, a)
+	}
+	if time.Since(r.Time) > time.Minute {
+		t.Error(r.Time)
+	}
+
+	r = records[1]
+	a = attrs(r)
+
+	if r.Level != slog.LevelError || r.Message != "failed" || a["user"] != "bob" || a["n"] != int64(5) {
+		t.Error(r, a)
+	}
+	if s, _ := a["obj"].(string); !strings.HasPrefix(s, "<object object at ") {
+		t.Error(a["obj"])
+	}
+	if s, _ := a["exception"].(string); !strings.Contains(s, "ZeroDivisionError") {
+		t.Error(a["exception"])
+	}
+	if src, _ := a[slog.SourceKey].(*slog.Source); src == nil || src.File != "<test>" || src.Line != 6 || src.Function != "<module>" {
+		t.Error(src)
+	}
+
+	for level, expect := range map[int]slog.Level{10: slog.LevelDebug, 20: slog.LevelInfo, 25: slog.LevelInfo + 2, 30: slog.LevelWarn, 40: slog.LevelError, 50: slog.LevelError + 4} {
+		if l := python.LogLevel(level); l != expect {
+			t.Error(level, l)
+		}
+	}
+}
+
+type closeRecorder struct {
+	*strings.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestEncodeFile(t *testing.T) {
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eval, err := builtin.Attr(nil, "eval")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := eval.Invoke(nil, `lambda f: (
+		f.readline(),
+		f.readline(3),
+		f.tell(),
+		f.read(4),
+		[line for line in f],
+		f.read(),
+		f.seek(-3, 2),
+		f.readlines(),
+		f.seek(0),
+		f.read(2),
+		f.seek(1, 1),
+		f.read(1),
+		f.readable(),
+		f.writable(),
+		f.seekable(),
+		f.isatty(),
+	)`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	python.TypedSequences = true
+	defer func() { python.TypedSequences = false }()
+
+	python.UnicodeStrings = true
+	defer func() { python.UnicodeStrings = false }()
+
+	r := &closeRecorder{Reader: strings.NewReader("first\nsecond\nthird\nfourth\n")}
+
+	result, err := read.InvokeValue(nil, python.File(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := fmt.Sprintf("%q", result); s != `["first\n" "sec" '\t' "ond\n" ["third\n" "fourth\n"] "" <nil> ["th\n"] <nil> "fi" <nil> "s" %!q(bool=true) %!q(bool=false) %!q(bool=true) %!q(bool=false)]` {
+		t.Error(s)
+	}
+
+	with, err := eval.Invoke(nil, `lambda f: [(x.read(1), x.closed) for x in [f]][0] + (f.closed, f.__exit__(None, None, None))`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r = &closeRecorder{Reader: strings.NewReader("f")}
+
+	if result, err := with.InvokeValue(nil, python.File(r)); err != nil {
+		t.Fatal(err)
+	} else if s := fmt.Sprint(result); s != "[f false false false]" || !r.closed {
+		t.Error(s, r.closed)
+	}
+
+	var buf bytes.Buffer
+
+	code, err := builtin.Call(nil, "compile", `
+import array
+print >>f, "hello", 42
+f.write(bytearray("ab"))
+f.write(memoryview("cd"))
+f.writelines(["e", array.array("c", "f")])
+f.flush()
+try:
+	f.write(u"x")
+except TypeError:
+	f.write("!")
+try:
+	f.read()
+except IOError:
+	f.write("?")
+f.close()
+try:
+	f.write("x")
+except ValueError:
+	pass
+`, "<test>", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builtin.Call(nil, "eval", code, map[interface{}]interface{}{"f": python.File(struct{ io.Writer }{&buf})}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := buf.String(); s != "hello 42\nabcdef!?" {
+		t.Errorf("%q", s)
+	}
+
+	// Data which Python doesn't ask for stays in the reader.
+	stream := struct{ io.Reader }{strings.NewReader("line\nrest")}
+
+	readline, err := eval.Invoke(nil, "lambda f: f.readline()", map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if line, err := readline.InvokeValue(nil, python.File(stream)); err != nil {
+		t.Fatal(err)
+	} else if line.(string) != "line\n" {
+		t.Errorf("%q", line)
+	}
+
+	if rest, err := io.ReadAll(stream); err != nil {
+		t.Fatal(err)
+	} else if string(rest) != "rest" {
+		t.Errorf("%q", rest)
+	}
+
+	closer := &closeRecorder{}
+
+	if _, err := builtin.Call(nil, "eval", "f.close()", map[interface{}]interface{}{"f": python.File(struct{ io.Closer }{closer})}); err != nil {
+		t.Fatal(err)
+	} else if !closer.closed {
+		t.Error("not closed")
+	}
+
+	reopen := "(f.close(), setattr(f, 'closed', False))"
+	if _, err := builtin.Call(nil, "eval", reopen, map[interface{}]interface{}{"f": python.File(strings.NewReader("x"))}); err == nil {
+		t.Error("closed file reopened")
+	}
+
+	if _, err := builtin.Call(nil, "repr", python.File(42)); err == nil {
+		t.Error("int translated to file")
+	}
+
+	if v, err := builtin.CallValue(nil, "repr", &buf); err != nil {
+		t.Fatal(err)
+	} else if v.(string) != "{}" {
+		t.Error(v)
+	}
+}
+
+func TestReaderWriter(t *testing.T) {
+	data := make([]byte, 200000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	ioModule, err := python.Import(nil, "io")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer, err := ioModule.Call(nil, "BytesIO")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := python.NewWriter(nil, buffer)
+
+	if n, err := w.Write(data[:10]); err != nil || n != 10 {
+		t.Fatal(n, err)
+	}
+	if n, err := io.Copy(w, bytes.NewReader(data[10:])); err != nil || n != int64(len(data)-10) {
+		t.Fatal(n, err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := buffer.Call(nil, "seek", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	r := python.NewReader(nil, buffer)
+
+	if b, err := io.ReadAll(r); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(b, data) {
+		t.Error(len(b))
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("writing to closed BytesIO succeeded")
+	}
+
+	stringIO, err := python.Import(nil, "StringIO")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := stringIO.Call(nil, "StringIO", python.Unicode("åäö\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := io.ReadAll(python.NewReader(nil, text)); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "åäö\n" {
+		t.Errorf("%q", b)
+	}
+
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := builtin.Call(nil, "eval", "lambda x: x", map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := identity.Invoke(nil, python.File(strings.NewReader("through Python")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := io.ReadAll(python.NewReader(nil, file)); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "through Python" {
+		t.Errorf("%q", b)
+	}
+
+	if _, err := python.NewReader(nil, nil).Read(make([]byte, 1)); err == nil {
+		t.Error("no error")
+	}
+
+	flaky, err := builtin.Call(nil, "eval", `(lambda chunks: type("Flaky", (object,), {
+		"read": lambda self, size: (lambda chunk: chunk if chunk != "!" else 1 // 0)(next(chunks)),
+	})())(iter(["abc", "!", "def", ""]))`, map[interface{}]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r = python.NewReader(nil, flaky)
+	p := make([]byte, 2)
+
+	for i, expect := range []string{"ab", "c", "error", "de", "f", "EOF"} {
+		var s string
+
+		if n, err := r.Read(p); err == io.EOF {
+			s = "EOF"
+		} else if err != nil {
+			s = "error"
+		} else {
+			s = string(p[:n])
+		}
+
+		if s != expect {
+			t.Errorf("read %d: %q", i, s)
+		}
+	}
+}
+
+func TestChan(t *testing.T) {
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := builtin.Call(nil, "compile", `
+closed = []
+
+def count(n):
+	try:
+		for i in range(n):
+			yield i
+	finally:
+		closed.append(n)
+
+def fail():
+	yield 1
+	raise ValueError("generator failed")
+`, "<test>", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	namespace, err := builtin.Call(nil, "dict")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builtin.Call(nil, "eval", code, namespace); err != nil {
+		t.Fatal(err)
+	}
+
+	count, _, err := namespace.Get(nil, "count")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gen, err := count.Invoke(nil, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, errs := gen.Chan(context.Background(), nil)
+
+	var sum int
+	for v := range values {
+		sum += v.(int)
+	}
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+	if sum != 10 {
+		t.Error(sum)
+	}
+
+	gen, err = count.Invoke(nil, 1000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	values, errs = gen.Chan(ctx, nil)
+
+	if v := <-values; v != 0 {
+		t.Error(v)
+	}
+	cancel()
+	for range values {
+	}
+	if err := <-errs; err != context.Canceled {
+		t.Error(err)
+	}
+
+	if closed, _, err := namespace.GetValue(nil, "closed"); err != nil {
+		t.Fatal(err)
+	} else if s := fmt.Sprint(closed); s != "[5 1000000]" {
+		t.Error(s)
+	}
+
+	fail, _, err := namespace.Get(nil, "fail")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gen, err = fail.Invoke(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, errs = gen.Chan(context.Background(), nil)
+	if v := <-values; v != 1 {
+		t.Error(v)
+	}
+	if _, ok := <-values; ok {
+		t.Error("values channel not closed")
+	}
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "generator failed") {
+		t.Error(err)
+	}
+
+	c := make(chan string)
+	go func() {
+		defer close(c)
+		for _, s := range []string{"a", "b", "c"} {
+			c <- s
+		}
+	}()
+
+	if v, err := builtin.CallValue(nil, "list", (<-chan string)(c)); err != nil {
+		t.Fatal(err)
+	} else if s := fmt.Sprint(v); s != "[a b c]" {
+		t.Error(s)
+	}
+
+	if _, err := builtin.Call(nil, "list", (chan<- string)(c)); err == nil {
+		t.Error("send-only channel translated")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	datetime, err := python.Import(nil, "datetime")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	globals := map[interface{}]interface{}{"datetime": datetime}
+
+	o, err := builtin.Call(nil, "eval", `{
+		1: [1.5, None, True, u"\xe4", "<&>"],
+		2.0: (2**70, -2**63, 2**64-1),
+		None: set([3]),
+		"d": datetime.date(2020, 1, 2),
+		"t": datetime.time(3, 4, 5, 6),
+		"b": bytearray("xy"),
+		"n": {},
+	}`, globals)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const expected = `{"1":[1.5,null,true,"ä","\u003c\u0026\u003e"],"2.0":[1180591620717411303424,-9223372036854775808,18446744073709551615],"b":"xy","d":"2020-01-02","n":{},"null":[3],"t":"03:04:05.000006"}`
+
+	data, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(data); s != expected {
+		t.Errorf("MarshalJSON: %s", s)
+	}
+
+	v, err := o.ValueJSON(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		t.Errorf("ValueJSON: %#v", v)
+	}
+
+	if data, err = json.Marshal(v); err != nil {
+		t.Fatal(err)
+	}
+	if s := string(data); s != expected {
+		t.Errorf("ValueJSON: %s", s)
+	}
+
+	for _, expr := range []string{
+		`1j`,
+		`[float("nan")]`,
+		`{(1, 2): 3}`,
+		`{1: 1, "1": 2}`,
+		`(lambda l: l.append(l) or l)([])`,
+		`type("D", (dict,), {"items": lambda self: [[1, 2]]})()`,
+		`type("D", (dict,), {"items": lambda self: iter([(1, 2)])})()`,
+	} {
+		o, err := builtin.Call(nil, "eval", expr, globals)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data, err := json.Marshal(o); err == nil {
+			t.Errorf("MarshalJSON %s: %s", expr, data)
+		}
+
+		if expr != `(lambda l: l.append(l) or l)([])` {
+			if v, err := o.ValueJSON(nil); err == nil {
+				t.Errorf("ValueJSON %s: %#v", expr, v)
+			}
+		}
+	}
+
+	jsonModule, err := python.Import(nil, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []float64{0.1, -0.0, 1e-5, 0.0001, 1e6, 1e15, 1e16, 1.5e16, 1.5e300} {
+		o, err := builtin.Call(nil, "dict", map[interface{}]interface{}{key: 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected, err := jsonModule.CallValue(nil, "dumps", o, false, true, true, true, nil, nil, []string{",", ":"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data, err := json.Marshal(o); err != nil {
+			t.Error(key, err)
+		} else if string(data) != expected {
+			t.Errorf("key %v: %s != %s", key, data, expected)
+		}
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	thread := python.NewThread()
+	defer thread.Close()
+
+	profiler := python.NewProfiler()
+
+	if err := thread.SetProfiler(profiler); err != nil {
+		t.Fatal(err)
+	}
+
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := builtin.Call(nil, "compile", `
+def f(n):
+	return len(range(n))
+
+def g():
+	return [f(i) for i in range(3)]
+
+g()
+`, "<test>", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builtin.Call(thread, "eval", code, map[interface{}]interface{}{"__name__": "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := thread.SetProfiler(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := make(map[string]int64)
+
+	for _, fn := range profiler.Functions() {
+		t.Logf("%s %s:%d calls=%d cumulative=%v self=%v", fn.Name, fn.Filename, fn.Line, fn.Calls, fn.Cumulative, fn.Self)
+
+		if fn.Cumulative < fn.Self {
+			t.Errorf("%s: cumulative %v < self %v", fn.Name, fn.Cumulative, fn.Self)
+		}
+
+		calls[fn.Name] = fn.Calls
+	}
+
+	for name, n := range map[string]int64{
+		"test.<module>":     1,
+		"test.g":            1,
+		"test.f":            3,
+		"__builtin__.len":   3,
+		"__builtin__.range": 4,
+	} {
+		if calls[name] != n {
+			t.Errorf("%s: %d calls", name, calls[name])
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := profiler.WriteProfile(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"test.f", "__builtin__.len", "<test>", "python_test.TestProfiler"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("profile doesn't contain %q", s)
+		}
+	}
+}
+
+func TestProfilerThreads(t *testing.T) {
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := builtin.Call(nil, "compile", `
+import time
+
+def nap():
+	time.sleep(0.05)
+
+nap()
+`, "<test>", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profiler := python.NewProfiler()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 2; i++ {
+		thread := python.NewThread()
+		defer thread.Close()
+
+		if err := thread.SetProfiler(profiler); err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := builtin.Call(thread, "eval", code, map[interface{}]interface{}{"__name__": "test"}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, fn := range profiler.Functions() {
+		if fn.Name == "test.nap" {
+			// The calls overlap, but each one counts.
+			if fn.Calls != 2 || fn.Cumulative < 100*time.Millisecond {
+				t.Errorf("%s: calls=%d cumulative=%v", fn.Name, fn.Calls, fn.Cumulative)
+			}
+			return
+		}
+	}
+
+	t.Error("test.nap not found")
+}
+
+func TestMetrics(t *testing.T) {
+	thread := python.NewThread()
+	defer thread.Close()
+
+	builtin, err := python.Import(thread, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builtin.Call(thread, "eval", "1 / 0", map[interface{}]interface{}{}); err == nil {
+		t.Fatal("no error")
+	}
+
+	m := thread.Metrics()
+	t.Logf("%+v", m)
+
+	if m.Calls != 2 {
+		t.Errorf("calls: %d", m.Calls)
+	}
+	if m.Errors != 1 {
+		t.Errorf("errors: %d", m.Errors)
+	}
+	if m.Objects != 1 {
+		t.Errorf("objects: %d", m.Objects)
+	}
+	runtime.KeepAlive(builtin)
+
+	for _, h := range []python.Histogram{m.QueueWait, m.Execution} {
+		if h.Count != m.Calls || h.Sum <= 0 {
+			t.Errorf("histogram: %+v", h)
+		}
+
+		for i, b := range h.Buckets {
+			if b.Count > h.Count || (i > 0 && (b.Count < h.Buckets[i-1].Count || b.UpperBound <= h.Buckets[i-1].UpperBound)) {
+				t.Errorf("bucket %d: %+v", i, b)
+			}
+		}
+	}
+
+	idle := python.NewThread()
+	defer idle.Close()
+
+	if m := idle.Metrics(); m.Calls != 0 || m.QueueWait.Count != 0 {
+		t.Errorf("%+v", m)
+	}
+}
@@ -0,0 +1,125 @@
+package python
+
+/*
+
+#include <Python.h>
+
+*/
+import "C"
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// Decimal is translated to Python's decimal.Decimal type.  Decimal objects are
+// translated to it if RegisterDecimalDecoder has been called.  The value is
+// the exact string representation of the number, e.g. "12.50", "-1E+3" or
+// "NaN".
+type Decimal string
+
+// Rat converts the decimal number to a rational number.  The result is false
+// for infinities and NaNs.
+func (d Decimal) Rat() (*big.Rat, bool) {
+	return new(big.Rat).SetString(string(d))
+}
+
+// MarshalPython implements Marshaler.
+func (d Decimal) MarshalPython() (interface{}, error) {
+	class, err := standardClass(&decimalClass)
+	if err != nil {
+		return nil, err
+	}
+
+	return class.Invoke(nil, string(d))
+}
+
+// RegisterDecimalDecoder makes decimal.Decimal objects be translated to the
+// Decimal type.
+func RegisterDecimalDecoder() (err error) {
+	class, err := standardClass(&decimalClass)
+	if err != nil {
+		return
+	}
+
+	return RegisterDecoder(class, func(o Object) (interface{}, error) {
+		s, err := o.Str(nil)
+		return Decimal(s), err
+	})
+}
+
+// UUID is translated to Python's uuid.UUID type.  UUID objects are translated
+// to it if RegisterUUIDDecoder has been called.
+type UUID [16]byte
+
+// String formats the UUID in the canonical hyphenated form.
+func (u UUID) String() string {
+	b := make([]byte, 36)
+
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+
+	return string(b)
+}
+
+// MarshalPython implements Marshaler.
+func (u UUID) MarshalPython() (interface{}, error) {
+	class, err := standardClass(&uuidClass)
+	if err != nil {
+		return nil, err
+	}
+
+	return class.Invoke(nil, nil, Bytes(u[:]))
+}
+
+// RegisterUUIDDecoder makes uuid.UUID objects be translated to the UUID type.
+func RegisterUUIDDecoder() (err error) {
+	class, err := standardClass(&uuidClass)
+	if err != nil {
+		return
+	}
+
+	return RegisterDecoder(class, func(o Object) (value interface{}, err error) {
+		b, err := o.AttrValue(nil, "bytes")
+		if err != nil {
+			return
+		}
+
+		s, ok := b.(string)
+		if !ok || len(s) != 16 {
+			err = fmt.Errorf("UUID bytes attribute is %v", b)
+			return
+		}
+
+		var u UUID
+		copy(u[:], s)
+		value = u
+		return
+	})
+}
+
+var (
+	decimalClass = lazyClass{source: "from decimal import Decimal", name: "Decimal"}
+	uuidClass    = lazyClass{source: "from uuid import UUID", name: "UUID"}
+)
+
+// standardClass gets a class which is imported from the standard library on
+// first use.
+func standardClass(c *lazyClass) (class Object, err error) {
+	defaultThread.execute(func() {
+		var pyClass *C.PyObject
+
+		if pyClass, err = c.get(); err == nil {
+			class = newObject(pyClass)
+		}
+	})
+	return
+}
@@ -0,0 +1,227 @@
+package python
+
+/*
+
+#include <Python.h>
+
+#include <stdlib.h>
+
+*/
+import "C"
+
+import (
+	"io"
+	"sync"
+	"unsafe"
+)
+
+const (
+	stdoutIndex = iota
+	stderrIndex
+)
+
+var streamNames = [2]string{"stdout", "stderr"}
+
+// redirection holds an optional writer.
+type redirection struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (r *redirection) set(w io.Writer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.w = w
+}
+
+func (r *redirection) get() io.Writer {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.w
+}
+
+var (
+	outputs [2]redirection
+
+	streamLock sync.Mutex
+	streams    [2]*stream
+)
+
+// SetStdout redirects Python's sys.stdout to a Go writer.  Output of Threads
+// which have their own writer (see Thread.SetStdout) is not affected.  A nil
+// writer restores the original stream.
+func SetStdout(w io.Writer) error {
+	return redirect(nil, &outputs[stdoutIndex], stdoutIndex, w)
+}
+
+// SetStderr redirects Python's sys.stderr to a Go writer.  Output of Threads
+// which have their own writer (see Thread.SetStderr) is not affected.  A nil
+// writer restores the original stream.
+func SetStderr(w io.Writer) error {
+	return redirect(nil, &outputs[stderrIndex], stderrIndex, w)
+}
+
+// SetStdout redirects Python's sys.stdout to a Go writer when Python code is
+// executed by this Thread.  A nil writer restores the default set by the
+// SetStdout function.
+func (t *Thread) SetStdout(w io.Writer) error {
+	return redirect(t, &t.outputs[stdoutIndex], stdoutIndex, w)
+}
+
+// SetStderr redirects Python's sys.stderr to a Go writer when Python code is
+// executed by this Thread.  A nil writer restores the default set by the
+// SetStderr function.
+func (t *Thread) SetStderr(w io.Writer) error {
+	return redirect(t, &t.outputs[stderrIndex], stderrIndex, w)
+}
+
+func redirect(t *Thread, r *redirection, i int, w io.Writer) (err error) {
+	if w != nil {
+		if err = installStream(t, i); err != nil {
+			return
+		}
+	}
+
+	r.set(w)
+	return
+}
+
+// installStream replaces sys.stdout or sys.stderr with a stream which
+// dispatches writes to Go writers.  The original object is used when there is
+// no writer.
+func installStream(t *Thread, i int) (err error) {
+	if installedStream(i) {
+		return
+	}
+
+	s := &stream{
+		index:    i,
+		Encoding: "UTF-8",
+	}
+
+	cName := C.CString(streamNames[i])
+	defer C.free(unsafe.Pointer(cName))
+
+	t.execute(func() {
+		// Check again with the GIL held; it serializes installations, as
+		// no Python code is run below.
+		if installedStream(i) {
+			return
+		}
+
+		if pyOriginal := C.PySys_GetObject(cName); pyOriginal != nil {
+			s.original = newObject(pyOriginal)
+		}
+
+		var pyStream *C.PyObject
+
+		if pyStream, err = encode(Proxy(s)); err != nil {
+			return
+		}
+		defer C.Py_DecRef(pyStream)
+
+		if C.PySys_SetObject(cName, pyStream) < 0 {
+			err = getError()
+			return
+		}
+
+		streamLock.Lock()
+		streams[i] = s
+		streamLock.Unlock()
+	})
+	return
+}
+
+func installedStream(i int) bool {
+	streamLock.Lock()
+	defer streamLock.Unlock()
+
+	return streams[i] != nil
+}
+
+// stream is a Python file-like object.
+type stream struct {
+	index    int
+	original Object // may be nil
+
+	Softspace int // used by the print statement
+	Encoding  string
+	Closed    bool
+}
+
+func (s *stream) writer(t *Thread) (w io.Writer) {
+	if w = t.outputs[s.index].get(); w == nil {
+		w = outputs[s.index].get()
+	}
+	return
+}
+
+func (s *stream) Write(t *Thread, data Object) (err error) {
+	w := s.writer(t)
+	if w == nil {
+		if s.original != nil {
+			_, err = s.original.Call(t, "write", data)
+		}
+		return
+	}
+
+	if data == nil {
+		return typeError("expected a string or other character buffer object")
+	}
+
+	x, err := data.Value(t)
+	if err != nil {
+		return
+	}
+
+	switch x := x.(type) {
+	case string:
+		_, err = io.WriteString(w, x)
+
+	case []byte:
+		_, err = w.Write(x)
+
+	default:
+		err = typeError("expected a string or other character buffer object")
+	}
+	return
+}
+
+func (s *stream) Writelines(t *Thread, lines []Object) (err error) {
+	for _, line := range lines {
+		if err = s.Write(t, line); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *stream) Flush(t *Thread) (err error) {
+	w := s.writer(t)
+	if w == nil {
+		if s.original != nil {
+			_, err = s.original.Call(t, "flush")
+		}
+		return
+	}
+
+	if f, ok := w.(interface {
+		Flush() error
+	}); ok {
+		err = f.Flush()
+	}
+	return
+}
+
+func (s *stream) Isatty(t *Thread) (tty bool, err error) {
+	if s.writer(t) == nil && s.original != nil {
+		var x interface{}
+
+		if x, err = s.original.CallValue(t, "isatty"); err == nil {
+			tty, _ = x.(bool)
+		}
+	}
+	return
+}
@@ -0,0 +1,363 @@
+// Package wsgi serves HTTP requests with Python WSGI applications.
+package wsgi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tsavola/go-python"
+)
+
+// Handler implements http.Handler by calling a WSGI application (PEP 333).
+// Requests are dispatched to a pool of Threads; the number of Threads limits
+// the number of requests being handled concurrently.
+//
+// The request body is streamed to the application as wsgi.input, and the
+// response iterable is streamed to the client, flushing after every block.
+type Handler struct {
+	// ErrorLog receives application errors and wsgi.errors output.  If nil,
+	// the standard logger is used.
+	ErrorLog *log.Logger
+
+	app     python.Object
+	builtin python.Object
+	threads chan *python.Thread
+}
+
+// NewHandler creates a Thread pool of the given size for serving requests with
+// a WSGI application callable.
+func NewHandler(app python.Object, threads int) (h *Handler, err error) {
+	if threads < 1 {
+		err = errors.New("wsgi: thread pool size must be positive")
+		return
+	}
+
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		return
+	}
+
+	h = &Handler{
+		app:     app,
+		builtin: builtin,
+		threads: make(chan *python.Thread, threads),
+	}
+
+	for i := 0; i < threads; i++ {
+		h.threads <- python.NewThread()
+	}
+	return
+}
+
+// Close terminates the Threads after ongoing requests have been handled.
+func (h *Handler) Close() (err error) {
+	for i := 0; i < cap(h.threads); i++ {
+		(<-h.threads).Close()
+	}
+	return
+}
+
+// ServeHTTP calls the application.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t := <-h.threads
+	defer func() {
+		h.threads <- t
+	}()
+
+	resp := &response{w: w}
+	errorLog := &errorWriter{logger: h.ErrorLog}
+	defer errorLog.Flush()
+
+	if err := h.serve(t, r, resp, errorLog); err != nil {
+		h.logf("wsgi: %s %s: %v", r.Method, r.URL, err)
+
+		if !resp.committed {
+			// Discard the application's headers, e.g. Content-Length.
+			header := w.Header()
+			for key := range header {
+				delete(header, key)
+			}
+
+			header.Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "Internal Server Error\n")
+		}
+		return
+	}
+
+	resp.commit()
+}
+
+func (h *Handler) serve(t *python.Thread, r *http.Request, resp *response, errorLog *errorWriter) (err error) {
+	result, err := h.app.Invoke(t, h.environ(r, errorLog), python.Proxy(resp.startResponse))
+	if err != nil {
+		return
+	}
+	if result == nil {
+		return errors.New("application returned None")
+	}
+
+	defer func() {
+		if e := h.close(t, result); err == nil {
+			err = e
+		}
+	}()
+
+	iter, err := h.builtin.Call(t, "iter", result)
+	if err != nil {
+		return
+	}
+
+	for {
+		var block python.Object
+
+		if block, err = h.builtin.Call(t, "next", iter, nil); err != nil {
+			return
+		}
+
+		if block == nil {
+			if !resp.started {
+				err = errors.New("application did not call start_response")
+			}
+			return
+		}
+
+		var data interface{}
+
+		if data, err = block.Value(t); err != nil {
+			return
+		}
+
+		s, ok := data.(string)
+		if !ok {
+			return fmt.Errorf("response iterable yielded %s", block)
+		}
+
+		if err = resp.write([]byte(s)); err != nil {
+			return
+		}
+	}
+}
+
+// close calls the close method of the response iterable, if it has one.
+func (h *Handler) close(t *python.Thread, result python.Object) (err error) {
+	found, err := h.builtin.CallValue(t, "hasattr", result, "close")
+	if err != nil || found != true {
+		return
+	}
+
+	close, err := result.Attr(t, "close")
+	if err != nil || close == nil {
+		return
+	}
+
+	_, err = close.Invoke(t)
+	return
+}
+
+// environ creates the WSGI environment.
+func (h *Handler) environ(r *http.Request, errorLog *errorWriter) map[interface{}]interface{} {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+		port = "80"
+		if r.TLS != nil {
+			port = "443"
+		}
+	}
+
+	var body io.Reader = r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+
+	env := map[interface{}]interface{}{
+		python.Bytes("REQUEST_METHOD"):    python.Bytes(r.Method),
+		python.Bytes("SCRIPT_NAME"):       python.Bytes(""),
+		python.Bytes("PATH_INFO"):         python.Bytes(r.URL.Path),
+		python.Bytes("QUERY_STRING"):      python.Bytes(r.URL.RawQuery),
+		python.Bytes("SERVER_NAME"):       python.Bytes(host),
+		python.Bytes("SERVER_PORT"):       python.Bytes(port),
+		python.Bytes("SERVER_PROTOCOL"):   python.Bytes(r.Proto),
+		python.Bytes("REMOTE_ADDR"):       python.Bytes(remoteHost(r.RemoteAddr)),
+		python.Bytes("wsgi.version"):      python.Tuple{1, 0},
+		python.Bytes("wsgi.url_scheme"):   python.Bytes(scheme),
+		python.Bytes("wsgi.input"):        python.File(body),
+		python.Bytes("wsgi.errors"):       python.File(errorLog),
+		python.Bytes("wsgi.multithread"):  cap(h.threads) > 1,
+		python.Bytes("wsgi.multiprocess"): false,
+		python.Bytes("wsgi.run_once"):     false,
+	}
+
+	if r.ContentLength >= 0 {
+		env[python.Bytes("CONTENT_LENGTH")] = python.Bytes(strconv.FormatInt(r.ContentLength, 10))
+	}
+
+	for name, values := range r.Header {
+		key := strings.ToUpper(strings.Replace(name, "-", "_", -1))
+
+		switch key {
+		case "CONTENT_TYPE":
+			// No prefix.
+
+		case "CONTENT_LENGTH":
+			continue // Set above.
+
+		default:
+			key = "HTTP_" + key
+		}
+
+		env[python.Bytes(key)] = python.Bytes(strings.Join(values, ", "))
+	}
+
+	return env
+}
+
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// errorWriter implements wsgi.errors.  Complete lines are logged as separate
+// entries, so that the logger's prefix and flags apply to each of them.
+type errorWriter struct {
+	logger *log.Logger
+	line   []byte
+}
+
+func (w *errorWriter) Write(b []byte) (n int, err error) {
+	n = len(b)
+	w.line = append(w.line, b...)
+
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			return
+		}
+
+		if err = w.output(w.line[:i]); err != nil {
+			return
+		}
+
+		w.line = w.line[i+1:]
+	}
+}
+
+// Flush logs an incomplete line.
+func (w *errorWriter) Flush() (err error) {
+	if len(w.line) > 0 {
+		err = w.output(w.line)
+		w.line = nil
+	}
+	return
+}
+
+func (w *errorWriter) output(line []byte) error {
+	if w.logger != nil {
+		return w.logger.Output(3, string(line))
+	}
+	return log.Output(3, string(line))
+}
+
+// response implements start_response and the write callable.
+type response struct {
+	w         http.ResponseWriter
+	status    int
+	started   bool
+	committed bool
+}
+
+func (resp *response) startResponse(status string, headers [][]string, excInfo ...python.Object) (write interface{}, err error) {
+	if len(excInfo) > 1 {
+		err = fmt.Errorf("start_response takes at most 3 arguments (%d given)", 2+len(excInfo))
+		return
+	}
+
+	if resp.started {
+		if len(excInfo) == 0 || excInfo[0] == nil {
+			err = errors.New("start_response called twice without exc_info")
+			return
+		}
+		if resp.committed {
+			// PEP 333: re-raise the application's exception.
+			err = python.Reraise(excInfo[0])
+			return
+		}
+	}
+
+	code, err := strconv.Atoi(strings.SplitN(status, " ", 2)[0])
+	if err != nil || code < 100 || code > 999 {
+		err = fmt.Errorf("invalid status %q", status)
+		return
+	}
+
+	header := resp.w.Header()
+	for key := range header {
+		delete(header, key)
+	}
+
+	for _, pair := range headers {
+		if len(pair) != 2 {
+			err = fmt.Errorf("invalid header %q", pair)
+			return
+		}
+		header.Add(pair[0], pair[1])
+	}
+
+	resp.status = code
+	resp.started = true
+
+	write = python.Proxy(resp.write)
+	return
+}
+
+// commit sends the headers if they haven't been sent yet.
+func (resp *response) commit() {
+	if !resp.committed {
+		resp.w.WriteHeader(resp.status)
+		resp.committed = true
+	}
+}
+
+func (resp *response) write(data []byte) (err error) {
+	if !resp.started {
+		return errors.New("write called before start_response")
+	}
+
+	if len(data) == 0 {
+		return
+	}
+
+	resp.commit()
+
+	if _, err = resp.w.Write(data); err != nil {
+		return
+	}
+
+	if f, ok := resp.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return
+}
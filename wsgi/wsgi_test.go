@@ -0,0 +1,180 @@
+package wsgi_test
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tsavola/go-python"
+	"github.com/tsavola/go-python/wsgi"
+)
+
+const appSource = `
+import sys
+
+def application(environ, start_response):
+	path = environ["PATH_INFO"]
+
+	if path == "/echo":
+		body = environ["wsgi.input"].read(int(environ.get("CONTENT_LENGTH") or 0))
+		start_response("201 Created", [("Content-Type", "text/plain"), ("X-Method", environ["REQUEST_METHOD"])])
+		return [body.upper(), "|", environ["QUERY_STRING"], "|", environ["HTTP_X_CUSTOM"], "|", environ["wsgi.url_scheme"]]
+
+	if path == "/write":
+		write = start_response("200 OK", [("Content-Type", "text/plain")])
+		write("written ")
+		return generate()
+
+	if path == "/error":
+		print >>environ["wsgi.errors"], "logged"
+		raise ValueError("oops")
+
+	if path == "/reraise":
+		write = start_response("200 OK", [])
+		write("partial ")
+		try:
+			raise KeyError("original")
+		except KeyError:
+			try:
+				start_response("500 Internal Server Error", [], sys.exc_info())
+			except KeyError:
+				return ["reraised"]
+		return ["not reraised"]
+
+	if path == "/length-error":
+		start_response("200 OK", [("Content-Length", "5")])
+		raise ValueError("length")
+
+	if path == "/close-none":
+		start_response("200 OK", [])
+		return type("Result", (list,), {"close": None})(["closed"])
+
+	if path == "/late-error":
+		start_response("200 OK", [])
+		return failing()
+
+	start_response("404 Not Found", [("Content-Type", "text/plain")])
+	return ["not found"]
+
+def generate():
+	for i in range(3):
+		yield str(i)
+
+def failing():
+	yield "partial"
+	raise ValueError("late")
+`
+
+func TestHandler(t *testing.T) {
+	builtin, err := python.Import(nil, "__builtin__")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := builtin.Call(nil, "compile", appSource, "<app>", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	globals := map[interface{}]interface{}{"__name__": "app"}
+	namespace, err := builtin.Call(nil, "dict", globals)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := builtin.Call(nil, "eval", code, namespace); err != nil {
+		t.Fatal(err)
+	}
+
+	app, _, err := namespace.Get(nil, "application")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := wsgi.NewHandler(app, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+
+	var logged bytes.Buffer
+	handler.ErrorLog = log.New(&logged, "prefix: ", 0)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req, err := http.NewRequest("POST", server.URL+"/echo?a=1", strings.NewReader("hello"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			req.Header.Set("X-Custom", "custom")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != 201 || resp.Header.Get("X-Method") != "POST" || string(body) != "HELLO|a=1|custom|http" {
+				t.Error(resp.StatusCode, resp.Header, string(body))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for path, expect := range map[string]struct {
+		status int
+		body   string
+	}{
+		"/write":        {200, "written 012"},
+		"/missing":      {404, "not found"},
+		"/error":        {500, "Internal Server Error\n"},
+		"/reraise":      {200, "partial reraised"},
+		"/length-error": {500, "Internal Server Error\n"},
+		"/close-none":   {200, "closed"},
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != expect.status || string(body) != expect.body {
+			t.Error(path, resp.StatusCode, string(body))
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/late-error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 || string(body) != "partial" {
+		t.Error(resp.StatusCode, string(body))
+	}
+
+	if s := logged.String(); !strings.Contains(s, "prefix: logged\nprefix: ") || !strings.Contains(s, "oops") || !strings.Contains(s, "late") {
+		t.Error(s)
+	}
+}